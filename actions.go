@@ -1,8 +1,9 @@
 package cdp
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
+	"reflect"
 	"time"
 )
 
@@ -18,22 +19,97 @@ type CommandReply interface {
 }
 
 // Event holds the value returned by the server based on a matching MethodType name.
+// By default the event is found by its first occurrence.  Count, Collect, and Quiet allow an action to wait on repeated occurrences of the same event.
 type Event struct {
 	Name       string
 	Value      CommandReply
 	IsRequired bool
 	IsFound    bool
+
+	// Match filters the occurrences of the event.  An occurrence whose decoded value does not satisfy Match is ignored and leaves Value untouched.
+	// It runs on the read loop without the frame's lock, so it may use the frame but should return quickly.
+	Match func(value CommandReply) bool
+
+	// Group makes required events alternatives of each other.  The action waits until any one event of each group is found.
+	Group string
+
+	// Count is the number of occurrences needed for the event to be found.  Zero means one unless Quiet is set, in which case no occurrence is needed.
+	Count int
+
+	// Collect keeps the value of every occurrence in Values.  The first occurrence is unmarshaled into Value and later ones into new values of the same type.
+	Collect bool
+	Values  []CommandReply
+
+	// Quiet holds a required event open until no occurrence has arrived for the given duration after the action's commands completed.
+	Quiet time.Duration
+
+	// Found is the number of occurrences that have matched the frame.
+	Found int
+
+	// last is when the latest occurrence matched.
+	last time.Time
+}
+
+// required returns the number of occurrences needed for the event to be found.
+func (e Event) required() int {
+	if e.Count > 0 {
+		return e.Count
+	}
+	if e.Quiet > 0 {
+		return 0
+	}
+	return 1
+}
+
+// next returns the value that the next occurrence should be unmarshaled into.
+// Occurrences that still have to pass Match are unmarshaled into a new value so that Value only ever holds a matching occurrence.
+func (e Event) next() CommandReply {
+	if e.Match == nil && (!e.Collect || e.Found == 0) {
+		return e.Value
+	}
+	return reflect.New(reflect.TypeOf(e.Value).Elem()).Interface().(CommandReply)
+}
+
+// keep stores the matching occurrence v and returns the value that holds it.
+func (e Event) keep(v CommandReply) CommandReply {
+	if v == e.Value || e.Collect && e.Found > 0 {
+		return v
+	}
+	reflect.ValueOf(e.Value).Elem().Set(reflect.ValueOf(v).Elem())
+	return e.Value
+}
+
+// done indicates that the event has enough occurrences and, when Quiet is set, that no occurrence has arrived for the quiet period.
+func (e Event) done(act *Action) bool {
+	return e.IsFound && (e.Quiet == 0 || time.Since(act.quietSince(e)) >= e.Quiet)
+}
+
+// FirstFound returns the first of the events in the given group that was found.
+// Actions such as Click return their events so that the caller can learn which of several alternative events fired.
+func FirstFound(events []Event, group string) (Event, bool) {
+	for _, e := range events {
+		if e.Group == group && e.IsFound {
+			return e, true
+		}
+	}
+	return Event{}, false
 }
 
 // Command represents a single json request sent to the server over the websocket.
 type Command struct {
 	// Values required to make a chrome devtools protocol request.
-	ID     int64          `json:"id"`
-	Method string         `json:"method,omitempty"`
-	Params json.Marshaler `json:"params,omitempty"`
+	ID        int64          `json:"id"`
+	SessionID string         `json:"sessionId,omitempty"`
+	Method    string         `json:"method,omitempty"`
+	Params    json.Marshaler `json:"params,omitempty"`
 
 	Reply   CommandReply  `json:"-"` // The struct that will be filled when a matching command Id is found in a reply over the chrome websocket.
 	Timeout time.Duration `json:"-"` // How long until the current command experiences a timeout, which will halt the entire process.
+
+	// Build returns the params of the command from the completed commands that come before it, whose replies are filled in.
+	// It is called when the command is reached so that one action can run commands that depend on earlier replies.
+	// An error fails the action and is returned as it is.  Build runs without the frame's lock, so it may use the frame.
+	Build func(previous []Command) (json.Marshaler, error) `json:"-"`
 }
 
 // Action represents a collection of json requests (commands) and any events that those requests might trigger that need to be tracked.
@@ -41,36 +117,177 @@ type Action struct {
 	Commands     []Command
 	CommandIndex int
 	Events       map[string]Event
+
+	// CompleteChan sends the signal that the action is completed (all commands and events).
+	CompleteChan chan struct{}
+
+	// CommandChan sends the timeout of the next command once the previous command has been completed.
+	// Once every command is completed it sends the event timeout when one is set.
+	CommandChan chan (<-chan time.Time)
+
+	// Retry overrides the frame's retry policy for the action's commands.
+	Retry *RetryPolicy
+
+	// Timeout limits the whole action, from sending its first command until its required events are found.
+	// When zero the action is only limited by the timeouts of its commands and events.
+	Timeout time.Duration
+
+	// EventTimeout limits the wait on required events once every command completed.
+	// When zero the timeout of the last command keeps running while the action waits on events.
+	EventTimeout time.Duration
+
+	// err is the reason that the action was failed by the frame.
+	err error
+
+	// retries is the number of times the current command has been sent again.
+	retries int
+
+	// sent is when the current command was first sent.
+	sent time.Time
+
+	// written is when the write loop began to send the command with id writtenID.  It is only kept for instrumentation.
+	written   time.Time
+	writtenID int64
+
+	// started is when the action began to run.
+	started time.Time
+
+	// commandsDone is when the last command of the action completed.
+	commandsDone time.Time
+
+	// names holds the event names in the order that they were given to NewAction.
+	names []string
+
+	// recovery marks the actions that a reconnected frame runs to recover its sessions and domains before it accepts other actions.
+	recovery bool
 }
 
 // NewAction returns a newly created action with any events that will be triggered by commands the action will take.
 func NewAction(events []Event, commands []Command) *Action {
 	act := &Action{
-		Events:   make(map[string]Event),
-		Commands: commands,
+		Events:       make(map[string]Event),
+		Commands:     commands,
+		CompleteChan: make(chan struct{}, 1),
+		CommandChan:  make(chan (<-chan time.Time), len(commands)+1),
 	}
 	for _, e := range events {
+		e.IsFound = e.Found >= e.required()
 		act.Events[e.Name] = e
+		act.names = append(act.names, e.Name)
 	}
 	return act
 }
 
 // Run sends the current action to websocket code that will create a request.
 // Then the action will wait until all commands and expected events are completed.
+// Any number of actions can be run against the same frame at the same time.
 func (act *Action) Run(frame *Frame) error {
-	frame.SetCurrentAction(act)
-	commandTimeout := frame.CommandTimeout()
+	return act.RunContext(context.Background(), frame)
+}
+
+// RunContext runs the action until it is completed, a command times out, or the context is done.
+// Once the context is done the action is removed from the frame and any late replies to its commands are discarded.
+func (act *Action) RunContext(ctx context.Context, frame *Frame) (err error) {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	// The action has not been added to the frame yet so it is safe to set without the frame's lock.
+	act.started = time.Now()
+	commandTimeout := frame.CommandTimeout(act)
+	var actionTimeout <-chan time.Time
+	if act.Timeout > 0 {
+		t := time.NewTimer(act.Timeout)
+		defer t.Stop()
+		actionTimeout = t.C
+	}
+	if err := frame.AddAction(act); err != nil {
+		return err
+	}
+	defer func() { frame.actionComplete(act, err) }()
+
 	for {
 		select {
+		case <-ctx.Done():
+			frame.RemoveAction(act)
+			return ctx.Err()
+		case <-actionTimeout:
+			frame.RemoveAction(act)
+			frame.commandTimedOut(act)
+			return frame.timeoutError(act, PhaseAction)
 		case <-commandTimeout:
-			// The current action's current command has timed out.
-			return fmt.Errorf("command timeout %s", frame.ToJSON())
-		case <-frame.CacheCompleteChan:
-			// The current action is complete.
-			return nil
-		case commandTimeout = <-frame.CommandChan:
-			// Set the current timeout to the next command's timeout.
-			frame.Browser.Log.Print("Next command timeout set.")
+			// The action's current command, or its wait on events once every command completed, has timed out.
+			frame.RemoveAction(act)
+			frame.commandTimedOut(act)
+			if frame.IsCommandComplete(act) {
+				return frame.timeoutError(act, PhaseEvents)
+			}
+			return frame.timeoutError(act, PhaseCommand)
+		case <-act.CompleteChan:
+			// The action is complete unless the frame failed it.
+			return act.err
+		case commandTimeout = <-act.CommandChan:
+			// Set the current timeout to the next command's timeout or to the event timeout.
+			frame.LogAt(LogAll, "next command timeout set")
 		}
 	}
 }
+
+// isCommandComplete indicates that all commands are complete.
+func (act *Action) isCommandComplete() bool {
+	return act.CommandIndex == len(act.Commands)
+}
+
+// isComplete indicates that all commands and events are complete.
+func (act *Action) isComplete() bool {
+	if !act.isCommandComplete() {
+		return false
+	}
+	for _, e := range act.Events {
+		if e.IsRequired && e.Group == "" && !e.done(act) {
+			return false
+		}
+	}
+	for _, done := range act.groups() {
+		if !done {
+			return false
+		}
+	}
+	return true
+}
+
+// groups indicates for each group of required events whether one of its events is done.
+func (act *Action) groups() map[string]bool {
+	groups := map[string]bool{}
+	for _, e := range act.Events {
+		if e.IsRequired && e.Group != "" {
+			groups[e.Group] = groups[e.Group] || e.done(act)
+		}
+	}
+	return groups
+}
+
+// GetEvents returns the action's events in the order that they were given to NewAction.
+// Call it once the action has returned to learn which events were found.
+func (act *Action) GetEvents() []Event {
+	events := []Event{}
+	for _, name := range act.names {
+		events = append(events, act.Events[name])
+	}
+	return events
+}
+
+// quietSince returns when the event last became quiet: the later of its latest occurrence and the completion of the action's commands.
+func (act *Action) quietSince(e Event) time.Time {
+	if e.last.After(act.commandsDone) {
+		return e.last
+	}
+	return act.commandsDone
+}
+
+// command returns the command that is currently active or the very last command.
+func (act *Action) command() Command {
+	if act.isCommandComplete() {
+		return act.Commands[act.CommandIndex-1]
+	}
+	return act.Commands[act.CommandIndex]
+}
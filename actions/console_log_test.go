@@ -10,9 +10,15 @@ import (
 func TestConsoleLog(t *testing.T) {
 	srv := LocalServer()
 
-	browser := cdp.NewBrowser(BrowserPath, 9222, "test.log")
+	browser, err := cdp.NewBrowser(BrowserPath, 0, "test.log")
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	frame := cdp.Start(browser, cdp.LogDetails)
+	frame, err := cdp.Start(browser, cdp.LogDetails)
+	if err != nil {
+		t.Fatal(err)
+	}
 	defer frame.Stop(true)
 
 	if err := EnablePage(frame, time.Second*2); err != nil {
@@ -1,6 +1,7 @@
 package actions
 
 import (
+	"context"
 	"fmt"
 	"github.com/4ydx/cdp/protocol/css"
 	"github.com/4ydx/cdp/protocol/dom"
@@ -10,14 +11,19 @@ import (
 
 // GetComputedStyleForNode get the computed style for a node.
 func GetComputedStyleForNode(frame *cdp.Frame, nodeID dom.NodeID, timeout time.Duration) (*css.GetComputedStyleForNodeReply, error) {
+	return GetComputedStyleForNodeContext(context.Background(), frame, nodeID, timeout)
+}
+
+// GetComputedStyleForNodeContext is like GetComputedStyleForNode but stops waiting on the browser once the context is done.
+func GetComputedStyleForNodeContext(ctx context.Context, frame *cdp.Frame, nodeID dom.NodeID, timeout time.Duration) (*css.GetComputedStyleForNodeReply, error) {
 	action := cdp.NewAction(
 		[]cdp.Event{},
 		[]cdp.Command{
 			cdp.Command{ID: frame.RequestID.GetNext(), Method: css.CommandCSSGetComputedStyleForNode, Params: &css.GetComputedStyleForNodeArgs{NodeID: nodeID}, Reply: &css.GetComputedStyleForNodeReply{}, Timeout: timeout},
 		})
-	err := action.Run(frame)
+	err := action.RunContext(ctx, frame)
 	if err != nil {
-		frame.Browser.Log.Print(err)
+		frame.LogError(err)
 		return nil, err
 	}
 	return action.Commands[0].Reply.(*css.GetComputedStyleForNodeReply), nil
@@ -26,20 +32,26 @@ func GetComputedStyleForNode(frame *cdp.Frame, nodeID dom.NodeID, timeout time.D
 // WaitForComputedStyle finds the first element on a page by id, css, or xpath and waits until the given css propery is set to the given css value.
 // For instance, wait until the cssPropery "display" is set to cssValue "none".  That is, until the found html element disappears from view.
 func WaitForComputedStyle(frame *cdp.Frame, find, cssPropery, cssValue string, timeout time.Duration) error {
-	nodeID, err := FindFirstElementNodeID(frame, find, timeout)
+	return WaitForComputedStyleContext(context.Background(), frame, find, cssPropery, cssValue, timeout)
+}
+
+// WaitForComputedStyleContext is like WaitForComputedStyle but stops waiting on the browser once the context is done.
+func WaitForComputedStyleContext(ctx context.Context, frame *cdp.Frame, find, cssPropery, cssValue string, timeout time.Duration) error {
+	nodeID, err := FindFirstElementNodeIDContext(ctx, frame, find, timeout)
 	if err != nil {
-		frame.Browser.Log.Print(err)
+		frame.LogError(err)
 		return err
 	}
 	until := time.Now().Add(timeout)
 	for {
 		if time.Now().After(until) {
-			frame.Browser.Log.Print("timeout")
-			return fmt.Errorf("timeout")
+			err := fmt.Errorf("computed style %w %s %s", cdp.ErrTimeout, cssPropery, cssValue)
+			frame.LogError(err)
+			return err
 		}
-		style, err := GetComputedStyleForNode(frame, nodeID, timeout)
+		style, err := GetComputedStyleForNodeContext(ctx, frame, nodeID, timeout)
 		if err != nil {
-			frame.Browser.Log.Print(err)
+			frame.LogError(err)
 			return err
 		}
 		match := false
@@ -1,7 +1,10 @@
 package actions
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/4ydx/cdp/protocol/dom"
 	"github.com/4ydx/cdp/protocol/input"
 	"github.com/4ydx/chrome-protocol"
@@ -10,9 +13,14 @@ import (
 
 // GetEntireDocument retrieves the root document and all children for the entire page.
 func GetEntireDocument(frame *cdp.Frame, timeout time.Duration) (*dom.GetFlattenedDocumentReply, error) {
+	return GetEntireDocumentContext(context.Background(), frame, timeout)
+}
+
+// GetEntireDocumentContext is like GetEntireDocument but stops waiting on the browser once the context is done.
+func GetEntireDocumentContext(ctx context.Context, frame *cdp.Frame, timeout time.Duration) (*dom.GetFlattenedDocumentReply, error) {
 	frameDOM := frame.GetDOM()
 	if frameDOM != nil && len(frameDOM.Nodes) > 0 {
-		frame.Browser.Log.Print("Using cached Frame DOM.")
+		frame.LogAt(cdp.LogDetails, "using cached frame DOM")
 		return frameDOM, nil
 	}
 	a0 := cdp.NewAction(
@@ -20,9 +28,9 @@ func GetEntireDocument(frame *cdp.Frame, timeout time.Duration) (*dom.GetFlatten
 		[]cdp.Command{
 			cdp.Command{ID: frame.RequestID.GetNext(), Method: dom.CommandDOMGetFlattenedDocument, Params: &dom.GetFlattenedDocumentArgs{Depth: -1}, Reply: &dom.GetFlattenedDocumentReply{}, Timeout: timeout},
 		})
-	err := a0.Run(frame)
+	err := a0.RunContext(ctx, frame)
 	if err != nil {
-		frame.Browser.Log.Print(err)
+		frame.LogError(err)
 		return nil, err
 	}
 	frame.SetDOM(a0.Commands[0].Reply.(*dom.GetFlattenedDocumentReply))
@@ -32,56 +40,44 @@ func GetEntireDocument(frame *cdp.Frame, timeout time.Duration) (*dom.GetFlatten
 
 // FindAll finds all nodes using XPath, CSS selector, or text.
 func FindAll(frame *cdp.Frame, find string, timeout time.Duration) ([]dom.Node, error) {
+	return FindAllContext(context.Background(), frame, find, timeout)
+}
+
+// FindAllContext is like FindAll but stops waiting on the browser once the context is done.
+func FindAllContext(ctx context.Context, frame *cdp.Frame, find string, timeout time.Duration) ([]dom.Node, error) {
 	found := make([]dom.Node, 0)
 
-	doc, err := GetEntireDocument(frame, timeout)
+	doc, err := GetEntireDocumentContext(ctx, frame, timeout)
 	if err != nil {
-		frame.Browser.Log.Print(err)
+		frame.LogError(err)
 		return found, err
 	}
 
-	// Make nodeId search request.
-	a0 := cdp.NewAction(
+	// Search for the nodes and then retrieve the NodeIds of the results.
+	act := cdp.NewAction(
 		[]cdp.Event{},
 		[]cdp.Command{
 			cdp.Command{ID: frame.RequestID.GetNext(), Method: dom.CommandDOMPerformSearch, Params: &dom.PerformSearchArgs{Query: find}, Reply: &dom.PerformSearchReply{}, Timeout: timeout},
+			cdp.Command{ID: frame.RequestID.GetNext(), Method: dom.CommandDOMGetSearchResults, Reply: &dom.GetSearchResultsReply{}, Timeout: timeout, Build: func(previous []cdp.Command) (json.Marshaler, error) {
+				ret := previous[0].Reply.(*dom.PerformSearchReply)
+				if ret.SearchID == "" {
+					return nil, errors.New("unexpected empty search id")
+				}
+				if ret.ResultCount == 0 {
+					return nil, fmt.Errorf("%w: %s", cdp.ErrNodeNotFound, find)
+				}
+				return &dom.GetSearchResultsArgs{SearchID: ret.SearchID, FromIndex: 0, ToIndex: ret.ResultCount}, nil
+			}},
 		})
-	err = a0.Run(frame)
+	act.Timeout = timeout
+	err = act.RunContext(ctx, frame)
 	if err != nil {
-		frame.Browser.Log.Print(err)
-		return found, err
-	}
-	ret := a0.Commands[0].Reply.(*dom.PerformSearchReply)
-	if ret.SearchID == "" {
-		err := errors.New("unexpected empty search id")
-		frame.Browser.Log.Print(err)
-		return found, err
-	}
-	if ret.ResultCount == 0 {
-		err := errors.New("no nodes found")
-		frame.Browser.Log.Print(err)
-		return found, err
-	}
-
-	// Retrieve the NodeIds.
-	params := &dom.GetSearchResultsArgs{
-		SearchID:  ret.SearchID,
-		FromIndex: 0,
-		ToIndex:   ret.ResultCount,
-	}
-	a1 := cdp.NewAction(
-		[]cdp.Event{},
-		[]cdp.Command{
-			cdp.Command{ID: frame.RequestID.GetNext(), Method: dom.CommandDOMGetSearchResults, Params: params, Reply: &dom.GetSearchResultsReply{}, Timeout: timeout},
-		})
-	err = a1.Run(frame)
-	if err != nil {
-		frame.Browser.Log.Print(err)
+		frame.LogError(err)
 		return found, err
 	}
 
 	// Find the matching nodes from the document
-	hits := a1.Commands[0].Reply.(*dom.GetSearchResultsReply)
+	hits := act.Commands[1].Reply.(*dom.GetSearchResultsReply)
 	for _, child := range doc.Nodes {
 		for _, id := range hits.NodeIDs {
 			if id == child.NodeID {
@@ -94,14 +90,19 @@ func FindAll(frame *cdp.Frame, find string, timeout time.Duration) ([]dom.Node,
 
 // FindFirstElementNodeID gets the first element's nodeId using XPath, Css selector, or text matches with the find parameter.
 func FindFirstElementNodeID(frame *cdp.Frame, find string, timeout time.Duration) (dom.NodeID, error) {
-	nodes, err := FindAll(frame, find, timeout)
+	return FindFirstElementNodeIDContext(context.Background(), frame, find, timeout)
+}
+
+// FindFirstElementNodeIDContext is like FindFirstElementNodeID but stops waiting on the browser once the context is done.
+func FindFirstElementNodeIDContext(ctx context.Context, frame *cdp.Frame, find string, timeout time.Duration) (dom.NodeID, error) {
+	nodes, err := FindAllContext(ctx, frame, find, timeout)
 	if err != nil {
-		frame.Browser.Log.Print(err)
+		frame.LogError(err)
 		return 0, err
 	}
 	if len(nodes) == 0 {
-		err := errors.New("no element found")
-		frame.Browser.Log.Print(err)
+		err := fmt.Errorf("%w: %s", cdp.ErrNodeNotFound, find)
+		frame.LogError(err)
 		return 0, err
 	}
 	target := dom.NodeID(0)
@@ -113,8 +114,8 @@ func FindFirstElementNodeID(frame *cdp.Frame, find string, timeout time.Duration
 		}
 	}
 	if target == 0 {
-		err := errors.New("no element (NodeType 1) found within matching nodes")
-		frame.Browser.Log.Print(err)
+		err := fmt.Errorf("%w: no element (NodeType 1) found within matching nodes for %s", cdp.ErrNodeNotFound, find)
+		frame.LogError(err)
 		return 0, err
 	}
 	return target, nil
@@ -122,18 +123,23 @@ func FindFirstElementNodeID(frame *cdp.Frame, find string, timeout time.Duration
 
 // Focus on the first element node that matches the find parameter.
 func Focus(frame *cdp.Frame, find string, timeout time.Duration) error {
-	target, err := FindFirstElementNodeID(frame, find, timeout)
+	return FocusContext(context.Background(), frame, find, timeout)
+}
+
+// FocusContext is like Focus but stops waiting on the browser once the context is done.
+func FocusContext(ctx context.Context, frame *cdp.Frame, find string, timeout time.Duration) error {
+	target, err := FindFirstElementNodeIDContext(ctx, frame, find, timeout)
 	if err != nil {
-		frame.Browser.Log.Print(err)
+		frame.LogError(err)
 		return err
 	}
 	err = cdp.NewAction(
 		[]cdp.Event{},
 		[]cdp.Command{
 			cdp.Command{ID: frame.RequestID.GetNext(), Method: dom.CommandDOMFocus, Params: &dom.FocusArgs{NodeID: target}, Reply: &dom.FocusReply{}, Timeout: timeout},
-		}).Run(frame)
+		}).RunContext(ctx, frame)
 	if err != nil {
-		frame.Browser.Log.Print(err)
+		frame.LogError(err)
 		return err
 	}
 	return nil
@@ -142,81 +148,93 @@ func Focus(frame *cdp.Frame, find string, timeout time.Duration) error {
 // Click on the first element matching the find parameter.
 // Any events that need to be tracked as a result of the click must be included.
 // This will insure that the click action waits until required events are fired.
+// The returned events are in the given order with IsFound set, so required events that share a Group tell which alternative fired.
 func Click(frame *cdp.Frame, find string, events []cdp.Event, timeout time.Duration) ([]cdp.Event, error) {
-	return ClickWithModifiers(frame, find, 0, events, timeout)
+	return ClickContext(context.Background(), frame, find, events, timeout)
+}
+
+// ClickContext is like Click but stops waiting on the browser once the context is done.
+func ClickContext(ctx context.Context, frame *cdp.Frame, find string, events []cdp.Event, timeout time.Duration) ([]cdp.Event, error) {
+	return ClickWithModifiersContext(ctx, frame, find, 0, events, timeout)
 }
 
 // ClickWithModifiers clicks on a found element using the specified key modifier values.
 func ClickWithModifiers(frame *cdp.Frame, find string, modifiers int, events []cdp.Event, timeout time.Duration) ([]cdp.Event, error) {
-	target, err := FindFirstElementNodeID(frame, find, timeout)
+	return ClickWithModifiersContext(context.Background(), frame, find, modifiers, events, timeout)
+}
+
+// ClickWithModifiersContext is like ClickWithModifiers but stops waiting on the browser once the context is done.
+func ClickWithModifiersContext(ctx context.Context, frame *cdp.Frame, find string, modifiers int, events []cdp.Event, timeout time.Duration) ([]cdp.Event, error) {
+	target, err := FindFirstElementNodeIDContext(ctx, frame, find, timeout)
 	if err != nil {
-		frame.Browser.Log.Print(err)
+		frame.LogError(err)
 		return events, err
 	}
-	return ClickNodeID(frame, target, modifiers, events, timeout)
+	return ClickNodeIDContext(ctx, frame, target, modifiers, events, timeout)
 }
 
 // ClickNodeID clicks on the element identified by the given dom.NodeID value.
+// Finding the node's box model and pressing and releasing the mouse run as a single action that is limited by the timeout.
 func ClickNodeID(frame *cdp.Frame, nodeID dom.NodeID, modifiers int, events []cdp.Event, timeout time.Duration) ([]cdp.Event, error) {
-	a0 := cdp.NewAction(
-		[]cdp.Event{},
-		[]cdp.Command{
-			cdp.Command{ID: frame.RequestID.GetNext(), Method: dom.CommandDOMGetBoxModel, Params: &dom.GetBoxModelArgs{NodeID: nodeID}, Reply: &dom.GetBoxModelReply{}, Timeout: timeout},
-		})
-	err := a0.Run(frame)
-	if err != nil {
-		frame.Browser.Log.Print(err)
-		return events, err
-	}
-
-	// Box is an array of quad vertices, x immediately followed by y for each point, points clock-wise.
-	// (0, 1), (2, 3) <- upper edge
-	// (4, 5), (6, 7) <- lower edge
-	box := a0.Commands[0].Reply.(*dom.GetBoxModelReply).Model.Content
-	xMid := (box[2]-box[0])/2 + box[0]
-	yMid := (box[5]-box[1])/2 + box[1]
+	return ClickNodeIDContext(context.Background(), frame, nodeID, modifiers, events, timeout)
+}
 
-	// Mouse click.
+// ClickNodeIDContext is like ClickNodeID but stops waiting on the browser once the context is done.
+func ClickNodeIDContext(ctx context.Context, frame *cdp.Frame, nodeID dom.NodeID, modifiers int, events []cdp.Event, timeout time.Duration) ([]cdp.Event, error) {
+	// Press and release the mouse in the middle of the node's content box.
 	left := input.MouseButtonLeft
-	err = cdp.NewAction(
-		events,
-		[]cdp.Command{
-			cdp.Command{ID: frame.RequestID.GetNext(), Method: input.CommandInputDispatchMouseEvent, Params: &input.DispatchMouseEventArgs{
-				Modifiers:  modifiers,
-				X:          xMid,
-				Y:          yMid,
-				Button:     &left,
-				ClickCount: 1,
-				Type:       "mousePressed",
-			}, Reply: &input.DispatchMouseEventReply{}, Timeout: timeout},
-			cdp.Command{ID: frame.RequestID.GetNext(), Method: input.CommandInputDispatchMouseEvent, Params: &input.DispatchMouseEventArgs{
+	click := func(kind string) func(previous []cdp.Command) (json.Marshaler, error) {
+		return func(previous []cdp.Command) (json.Marshaler, error) {
+			// Box is an array of quad vertices, x immediately followed by y for each point, points clock-wise.
+			// (0, 1), (2, 3) <- upper edge
+			// (4, 5), (6, 7) <- lower edge
+			box := previous[0].Reply.(*dom.GetBoxModelReply).Model.Content
+			if len(box) < 8 {
+				return nil, fmt.Errorf("%w: no box model for node %d", cdp.ErrNodeNotFound, nodeID)
+			}
+			return &input.DispatchMouseEventArgs{
 				Modifiers:  modifiers,
-				X:          xMid,
-				Y:          yMid,
+				X:          (box[2]-box[0])/2 + box[0],
+				Y:          (box[5]-box[1])/2 + box[1],
 				Button:     &left,
 				ClickCount: 1,
-				Type:       "mouseReleased",
-			}, Reply: &input.DispatchMouseEventReply{}, Timeout: timeout},
-		}).Run(frame)
+				Type:       kind,
+			}, nil
+		}
+	}
+	act := cdp.NewAction(
+		events,
+		[]cdp.Command{
+			cdp.Command{ID: frame.RequestID.GetNext(), Method: dom.CommandDOMGetBoxModel, Params: &dom.GetBoxModelArgs{NodeID: nodeID}, Reply: &dom.GetBoxModelReply{}, Timeout: timeout},
+			cdp.Command{ID: frame.RequestID.GetNext(), Method: input.CommandInputDispatchMouseEvent, Reply: &input.DispatchMouseEventReply{}, Timeout: timeout, Build: click("mousePressed")},
+			cdp.Command{ID: frame.RequestID.GetNext(), Method: input.CommandInputDispatchMouseEvent, Reply: &input.DispatchMouseEventReply{}, Timeout: timeout, Build: click("mouseReleased")},
+		})
+	act.Timeout = timeout
+	err := act.RunContext(ctx, frame)
 	if err != nil {
-		frame.Browser.Log.Print(err)
-		return events, err
+		frame.LogError(err)
+		return act.GetEvents(), err
 	}
-	return events, nil
+	return act.GetEvents(), nil
 }
 
 // Children of the first element node that matches the find parameter.  If the frame.DOM object already has the data, this call will do nothing.  Otherwise, it should trigger DOM.setChildNodes events.
 // NOTE: It appears that before this action will be completed (before the reply is received), if the server has not yet sent any/some of the child nodes of the given nodeID, then it will send those to the client
 //       as DOM.setChildNodes events.  We do not need to pick those up here since there is a method in the websocket loop of github.com/4ydx/chrome-protocol that watches for such events and updates the DOM object.
-//       In fact, I don't know how many of those events might be fired and an action's event slice isn't designed to handle multiples of the same event type.
+//       Since it is not known how many of those events will be fired, an action that needs all of them should wait on the event with cdp.Event's Collect and Quiet set.
 func Children(frame *cdp.Frame, nodeID dom.NodeID, timeout time.Duration) error {
+	return ChildrenContext(context.Background(), frame, nodeID, timeout)
+}
+
+// ChildrenContext is like Children but stops waiting on the browser once the context is done.
+func ChildrenContext(ctx context.Context, frame *cdp.Frame, nodeID dom.NodeID, timeout time.Duration) error {
 	err := cdp.NewAction(
 		[]cdp.Event{},
 		[]cdp.Command{
 			cdp.Command{ID: frame.RequestID.GetNext(), Method: dom.CommandDOMRequestChildNodes, Params: &dom.RequestChildNodesArgs{NodeID: nodeID, Depth: -1}, Reply: &dom.RequestChildNodesReply{}, Timeout: timeout},
-		}).Run(frame)
+		}).RunContext(ctx, frame)
 	if err != nil {
-		frame.Browser.Log.Print(err)
+		frame.LogError(err)
 		return err
 	}
 	return nil
@@ -224,13 +242,18 @@ func Children(frame *cdp.Frame, nodeID dom.NodeID, timeout time.Duration) error
 
 // SetAttributeValue sets the value of the given attribute of the given nodeID to the given value.
 func SetAttributeValue(frame *cdp.Frame, nodeID dom.NodeID, name, value string, timeout time.Duration) error {
+	return SetAttributeValueContext(context.Background(), frame, nodeID, name, value, timeout)
+}
+
+// SetAttributeValueContext is like SetAttributeValue but stops waiting on the browser once the context is done.
+func SetAttributeValueContext(ctx context.Context, frame *cdp.Frame, nodeID dom.NodeID, name, value string, timeout time.Duration) error {
 	err := cdp.NewAction(
 		[]cdp.Event{},
 		[]cdp.Command{
 			cdp.Command{ID: frame.RequestID.GetNext(), Method: dom.CommandDOMSetAttributeValue, Params: &dom.SetAttributeValueArgs{NodeID: nodeID, Name: name, Value: value}, Reply: &dom.SetAttributeValueReply{}, Timeout: timeout},
-		}).Run(frame)
+		}).RunContext(ctx, frame)
 	if err != nil {
-		frame.Browser.Log.Print(err)
+		frame.LogError(err)
 		return err
 	}
 	return nil
@@ -1,18 +1,27 @@
 package actions
 
 import (
+	"errors"
 	"github.com/4ydx/cdp/protocol/dom"
+	"github.com/4ydx/cdp/protocol/input"
 	"github.com/4ydx/cdp/protocol/page"
 	"github.com/4ydx/chrome-protocol"
+	"github.com/4ydx/chrome-protocol/cdptest"
 	"strings"
 	"testing"
 	"time"
 )
 
 func TestClick(t *testing.T) {
-	browser := cdp.NewBrowser(BrowserPath, 9222, "dom_test.log")
+	browser, err := cdp.NewBrowser(BrowserPath, 0, "dom_test.log")
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	frame := cdp.Start(browser, cdp.LogDetails)
+	frame, err := cdp.Start(browser, cdp.LogDetails)
+	if err != nil {
+		t.Fatal(err)
+	}
 	defer frame.Stop(true)
 
 	// Enable page, dom, and network events
@@ -43,7 +52,7 @@ func TestClick(t *testing.T) {
 		cdp.Event{Name: page.EventPageNavigatedWithinDocument, Value: &page.NavigatedWithinDocumentReply{}, IsRequired: true},
 	}
 	events = append(events, GetNavigationEvents()...)
-	events, err := Click(frame, "gb_70", events, time.Second*5)
+	events, err = Click(frame, "gb_70", events, time.Second*5)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -55,9 +64,15 @@ func TestClick(t *testing.T) {
 }
 
 func TestDOMClearedWhenEventSpecified(t *testing.T) {
-	browser := cdp.NewBrowser(BrowserPath, 9222, "dom_test.log")
+	browser, err := cdp.NewBrowser(BrowserPath, 0, "dom_test.log")
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	frame := cdp.Start(browser, cdp.LogAll)
+	frame, err := cdp.Start(browser, cdp.LogAll)
+	if err != nil {
+		t.Fatal(err)
+	}
 	defer frame.Stop(true)
 
 	// Enable page, dom, and network events
@@ -85,7 +100,7 @@ func TestDOMClearedWhenEventSpecified(t *testing.T) {
 	}
 	events = append(events, GetNavigationEvents()...)
 
-	events, err := Click(frame, "gb_70", events, time.Second*5)
+	events, err = Click(frame, "gb_70", events, time.Second*5)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -102,9 +117,15 @@ func TestDOMClearedWhenEventSpecified(t *testing.T) {
 }
 
 func TestDOMClearedWhenEventNotSpecified(t *testing.T) {
-	browser := cdp.NewBrowser(BrowserPath, 9222, "dom_test.log")
+	browser, err := cdp.NewBrowser(BrowserPath, 0, "dom_test.log")
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	frame := cdp.Start(browser, cdp.LogAll)
+	frame, err := cdp.Start(browser, cdp.LogAll)
+	if err != nil {
+		t.Fatal(err)
+	}
 	defer frame.Stop(true)
 
 	// Enable page, dom, and network events
@@ -129,7 +150,7 @@ func TestDOMClearedWhenEventNotSpecified(t *testing.T) {
 	}
 	events = append(events, GetNavigationEvents()...)
 
-	events, err := Click(frame, "gb_70", events, time.Second*10)
+	events, err = Click(frame, "gb_70", events, time.Second*10)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -144,3 +165,87 @@ func TestDOMClearedWhenEventNotSpecified(t *testing.T) {
 		t.Fatal("Expecting the Frame.DOM object to be set to nil due to a dom.documentUpdated event.")
 	}
 }
+
+func TestClickNodeIDFake(t *testing.T) {
+	server := cdptest.NewServer()
+	defer server.Close()
+
+	server.Reply(dom.CommandDOMGetBoxModel, map[string]interface{}{"model": map[string]interface{}{"content": []float64{0, 0, 10, 0, 10, 10, 0, 10}}})
+	server.Handle(input.CommandInputDispatchMouseEvent, func(m cdp.Message) cdptest.Response {
+		if !strings.Contains(string(m.Params), "mouseReleased") {
+			return cdptest.Response{}
+		}
+		// The click only changes the fragment of the url so the frame is not navigated.
+		return cdptest.Response{Events: []cdptest.Event{
+			{Method: page.EventPageNavigatedWithinDocument, Params: map[string]string{"frameId": "F1", "url": "https://example.com/#help"}},
+		}}
+	})
+
+	frame, err := cdp.Start(server.Browser(), cdp.LogBasic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer frame.Stop(false)
+
+	events, err := ClickNodeID(frame, 5, 0, []cdp.Event{
+		cdp.Event{Name: page.EventPageFrameNavigated, Value: &page.FrameNavigatedReply{}, IsRequired: true, Group: "navigation"},
+		cdp.Event{Name: page.EventPageNavigatedWithinDocument, Value: &page.NavigatedWithinDocumentReply{}, IsRequired: true, Group: "navigation"},
+	}, time.Second*2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fired, ok := cdp.FirstFound(events, "navigation")
+	if !ok || fired.Name != page.EventPageNavigatedWithinDocument {
+		t.Fatalf("Expecting the navigation within the document to be found but got %+v", events)
+	}
+	if url := fired.Value.(*page.NavigatedWithinDocumentReply).URL; url != "https://example.com/#help" {
+		t.Fatalf("incorrect url %s", url)
+	}
+	if events[0].Name != page.EventPageFrameNavigated || events[0].IsFound {
+		t.Fatalf("Expecting the events in the given order with the frame navigation not found but got %+v", events)
+	}
+}
+
+func TestFindAllFake(t *testing.T) {
+	server := cdptest.NewServer()
+	defer server.Close()
+
+	server.Reply(dom.CommandDOMGetFlattenedDocument, map[string]interface{}{"nodes": []map[string]interface{}{
+		{"nodeId": 1, "nodeType": 9, "nodeName": "#document"},
+		{"nodeId": 2, "parentId": 1, "nodeType": 1, "nodeName": "BUTTON"},
+		{"nodeId": 3, "parentId": 1, "nodeType": 1, "nodeName": "BUTTON"},
+	}})
+	server.Reply(dom.CommandDOMPerformSearch, map[string]interface{}{"searchId": "S1", "resultCount": 2})
+	server.Reply(dom.CommandDOMGetSearchResults, map[string]interface{}{"nodeIds": []int{3}})
+
+	frame, err := cdp.Start(server.Browser(), cdp.LogBasic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer frame.Stop(false)
+
+	nodes, err := FindAll(frame, "button", time.Second*2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 1 || nodes[0].NodeID != 3 {
+		t.Fatalf("Expecting the searched node but got %+v", nodes)
+	}
+	results, err := server.WaitFor(dom.CommandDOMGetSearchResults, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(results.Params) != `{"searchId":"S1","fromIndex":0,"toIndex":2}` {
+		t.Fatalf("Expecting the search results to be requested for the search but got %s", results.Params)
+	}
+
+	// The results are not requested when the search finds nothing.
+	server.Reply(dom.CommandDOMPerformSearch, map[string]interface{}{"searchId": "S2", "resultCount": 0})
+	if _, err := FindAll(frame, "missing", time.Second*2); !errors.Is(err, cdp.ErrNodeNotFound) {
+		t.Fatalf("Expecting the node not to be found but got %v", err)
+	}
+	methods := server.ReceivedMethods()
+	if methods[len(methods)-1] != dom.CommandDOMPerformSearch {
+		t.Fatalf("unexpected commands %v", methods)
+	}
+}
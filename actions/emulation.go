@@ -1,12 +1,19 @@
 package actions
 
 import (
+	"context"
 	"github.com/4ydx/cdp/protocol/emulation"
 	"github.com/4ydx/chrome-protocol"
 	"time"
 )
 
+// SetDeviceMetricsOverride overrides the device screen dimensions.
 func SetDeviceMetricsOverride(frame *cdp.Frame, width, height int, mobile bool, timeout time.Duration) error {
+	return SetDeviceMetricsOverrideContext(context.Background(), frame, width, height, mobile, timeout)
+}
+
+// SetDeviceMetricsOverrideContext is like SetDeviceMetricsOverride but stops waiting on the browser once the context is done.
+func SetDeviceMetricsOverrideContext(ctx context.Context, frame *cdp.Frame, width, height int, mobile bool, timeout time.Duration) error {
 	// await client.Emulation.setDeviceMetricsOverride({width: 1920, height: 1080, fitWindow: true, deviceScaleFactor: 1, mobile: false});
 	err := cdp.NewAction(
 		[]cdp.Event{},
@@ -17,9 +24,9 @@ func SetDeviceMetricsOverride(frame *cdp.Frame, width, height int, mobile bool,
 				DeviceScaleFactor: 1,
 				Mobile:            mobile,
 			}, Reply: &emulation.SetDeviceMetricsOverrideReply{}, Timeout: timeout},
-		}).Run(frame)
+		}).RunContext(ctx, frame)
 	if err != nil {
-		frame.Browser.Log.Print(err)
+		frame.LogError(err)
 		return err
 	}
 	return nil
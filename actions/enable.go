@@ -1,6 +1,7 @@
 package actions
 
 import (
+	"context"
 	"github.com/4ydx/cdp/protocol/css"
 	"github.com/4ydx/cdp/protocol/dom"
 	"github.com/4ydx/cdp/protocol/indexeddb"
@@ -14,9 +15,15 @@ import (
 )
 
 // EnableAll tells the server to send all event values across the websocket.
+// The timeout limits each command as well as the action as a whole.
 func EnableAll(frame *cdp.Frame, timeout time.Duration) error {
+	return EnableAllContext(context.Background(), frame, timeout)
+}
+
+// EnableAllContext is like EnableAll but stops waiting on the browser once the context is done.
+func EnableAllContext(ctx context.Context, frame *cdp.Frame, timeout time.Duration) error {
 	// Order is important.  Dom should come first.
-	err := cdp.NewAction(
+	act := cdp.NewAction(
 		[]cdp.Event{},
 		[]cdp.Command{
 			cdp.Command{ID: frame.RequestID.GetNext(), Method: dom.CommandDOMEnable, Params: &dom.EnableArgs{}, Reply: &dom.EnableReply{}, Timeout: timeout},
@@ -27,100 +34,137 @@ func EnableAll(frame *cdp.Frame, timeout time.Duration) error {
 			cdp.Command{ID: frame.RequestID.GetNext(), Method: network.CommandNetworkEnable, Params: &network.EnableArgs{}, Reply: &network.EnableReply{}, Timeout: timeout},
 			cdp.Command{ID: frame.RequestID.GetNext(), Method: page.CommandPageEnable, Params: &page.EnableArgs{}, Reply: &page.EnableReply{}, Timeout: timeout},
 			cdp.Command{ID: frame.RequestID.GetNext(), Method: runtime.CommandRuntimeEnable, Params: &runtime.EnableArgs{}, Reply: &runtime.EnableReply{}, Timeout: timeout},
-		}).Run(frame)
+		})
+	act.Timeout = timeout
+	err := act.RunContext(ctx, frame)
 	if err != nil {
-		frame.Browser.Log.Print(err)
+		frame.LogError(err)
 	}
 	return err
 }
 
 // EnableDom tells the server to send the dom event values across the websocket.
 func EnableDom(frame *cdp.Frame, timeout time.Duration) error {
+	return EnableDomContext(context.Background(), frame, timeout)
+}
+
+// EnableDomContext is like EnableDom but stops waiting on the browser once the context is done.
+func EnableDomContext(ctx context.Context, frame *cdp.Frame, timeout time.Duration) error {
 	err := cdp.NewAction(
 		[]cdp.Event{},
 		[]cdp.Command{
 			cdp.Command{ID: frame.RequestID.GetNext(), Method: dom.CommandDOMEnable, Params: &dom.EnableArgs{}, Reply: &dom.EnableReply{}, Timeout: timeout},
-		}).Run(frame)
+		}).RunContext(ctx, frame)
 	if err != nil {
-		frame.Browser.Log.Print(err)
+		frame.LogError(err)
 	}
 	return err
 }
 
 // EnableLog tells the server to send the log event values across the websocket.
 func EnableLog(frame *cdp.Frame, timeout time.Duration) error {
+	return EnableLogContext(context.Background(), frame, timeout)
+}
+
+// EnableLogContext is like EnableLog but stops waiting on the browser once the context is done.
+func EnableLogContext(ctx context.Context, frame *cdp.Frame, timeout time.Duration) error {
 	err := cdp.NewAction(
 		[]cdp.Event{},
 		[]cdp.Command{
 			cdp.Command{ID: frame.RequestID.GetNext(), Method: log.CommandLogEnable, Params: &log.EnableArgs{}, Reply: &log.EnableReply{}, Timeout: timeout},
-		}).Run(frame)
+		}).RunContext(ctx, frame)
 	if err != nil {
-		frame.Browser.Log.Print(err)
+		frame.LogError(err)
 	}
 	return err
 }
 
 // EnablePage tells the server to send the page event values across the websocket.
 func EnablePage(frame *cdp.Frame, timeout time.Duration) error {
+	return EnablePageContext(context.Background(), frame, timeout)
+}
+
+// EnablePageContext is like EnablePage but stops waiting on the browser once the context is done.
+func EnablePageContext(ctx context.Context, frame *cdp.Frame, timeout time.Duration) error {
 	err := cdp.NewAction(
 		[]cdp.Event{},
 		[]cdp.Command{
 			cdp.Command{ID: frame.RequestID.GetNext(), Method: page.CommandPageEnable, Params: &page.EnableArgs{}, Reply: &page.EnableReply{}, Timeout: timeout},
-		}).Run(frame)
+		}).RunContext(ctx, frame)
 	if err != nil {
-		frame.Browser.Log.Print(err)
+		frame.LogError(err)
 	}
 	return err
 }
 
 // EnableNetwork tells the server to send the network event values across the websocket.
 func EnableNetwork(frame *cdp.Frame, timeout time.Duration) error {
+	return EnableNetworkContext(context.Background(), frame, timeout)
+}
+
+// EnableNetworkContext is like EnableNetwork but stops waiting on the browser once the context is done.
+func EnableNetworkContext(ctx context.Context, frame *cdp.Frame, timeout time.Duration) error {
 	err := cdp.NewAction(
 		[]cdp.Event{},
 		[]cdp.Command{
 			cdp.Command{ID: frame.RequestID.GetNext(), Method: network.CommandNetworkEnable, Params: &network.EnableArgs{}, Reply: &network.EnableReply{}, Timeout: timeout},
-		}).Run(frame)
+		}).RunContext(ctx, frame)
 	if err != nil {
-		frame.Browser.Log.Print(err)
+		frame.LogError(err)
 	}
 	return err
 }
 
 // EnableRuntime tells the server to send the runtime event values across the websocket.
 func EnableRuntime(frame *cdp.Frame, timeout time.Duration) error {
+	return EnableRuntimeContext(context.Background(), frame, timeout)
+}
+
+// EnableRuntimeContext is like EnableRuntime but stops waiting on the browser once the context is done.
+func EnableRuntimeContext(ctx context.Context, frame *cdp.Frame, timeout time.Duration) error {
 	err := cdp.NewAction(
 		[]cdp.Event{},
 		[]cdp.Command{
 			cdp.Command{ID: frame.RequestID.GetNext(), Method: runtime.CommandRuntimeEnable, Params: &runtime.EnableArgs{}, Reply: &runtime.EnableReply{}, Timeout: timeout},
-		}).Run(frame)
+		}).RunContext(ctx, frame)
 	if err != nil {
-		frame.Browser.Log.Print(err)
+		frame.LogError(err)
 	}
 	return err
 }
 
 // EnableCSS tells the server to send the css event values across the websocket.
 func EnableCSS(frame *cdp.Frame, timeout time.Duration) error {
+	return EnableCSSContext(context.Background(), frame, timeout)
+}
+
+// EnableCSSContext is like EnableCSS but stops waiting on the browser once the context is done.
+func EnableCSSContext(ctx context.Context, frame *cdp.Frame, timeout time.Duration) error {
 	err := cdp.NewAction(
 		[]cdp.Event{},
 		[]cdp.Command{
 			cdp.Command{ID: frame.RequestID.GetNext(), Method: css.CommandCSSEnable, Params: &css.EnableArgs{}, Reply: &css.EnableReply{}, Timeout: timeout},
-		}).Run(frame)
+		}).RunContext(ctx, frame)
 	if err != nil {
-		frame.Browser.Log.Print(err)
+		frame.LogError(err)
 	}
 	return err
 }
 
 // EnableIndexedDB tells the server to send the indexeddb event values across the websocket.
 func EnableIndexedDB(frame *cdp.Frame, timeout time.Duration) error {
+	return EnableIndexedDBContext(context.Background(), frame, timeout)
+}
+
+// EnableIndexedDBContext is like EnableIndexedDB but stops waiting on the browser once the context is done.
+func EnableIndexedDBContext(ctx context.Context, frame *cdp.Frame, timeout time.Duration) error {
 	err := cdp.NewAction(
 		[]cdp.Event{},
 		[]cdp.Command{
 			cdp.Command{ID: frame.RequestID.GetNext(), Method: indexeddb.CommandIndexedDBEnable, Params: &indexeddb.EnableArgs{}, Reply: &indexeddb.EnableReply{}, Timeout: timeout},
-		}).Run(frame)
+		}).RunContext(ctx, frame)
 	if err != nil {
-		frame.Browser.Log.Print(err)
+		frame.LogError(err)
 	}
 	return err
 }
@@ -7,9 +7,15 @@ import (
 )
 
 func TestEnable(t *testing.T) {
-	browser := cdp.NewBrowser(BrowserPath, 9222, "enable_test.log")
+	browser, err := cdp.NewBrowser(BrowserPath, 0, "enable_test.log")
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	frame := cdp.Start(browser, cdp.LogBasic)
+	frame, err := cdp.Start(browser, cdp.LogBasic)
+	if err != nil {
+		t.Fatal(err)
+	}
 	defer frame.Stop(true)
 
 	if err := EnablePage(frame, time.Second*2); err != nil {
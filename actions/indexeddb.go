@@ -1,6 +1,7 @@
 package actions
 
 import (
+	"context"
 	"github.com/4ydx/cdp/protocol/indexeddb"
 	"github.com/4ydx/chrome-protocol"
 	"time"
@@ -8,14 +9,19 @@ import (
 
 // RequestDatabaseNames returns a list of the databases controlled by the given security origin.
 func RequestDatabaseNames(frame *cdp.Frame, securityOrigin string, timeout time.Duration) (*indexeddb.RequestDatabaseNamesReply, error) {
+	return RequestDatabaseNamesContext(context.Background(), frame, securityOrigin, timeout)
+}
+
+// RequestDatabaseNamesContext is like RequestDatabaseNames but stops waiting on the browser once the context is done.
+func RequestDatabaseNamesContext(ctx context.Context, frame *cdp.Frame, securityOrigin string, timeout time.Duration) (*indexeddb.RequestDatabaseNamesReply, error) {
 	action := cdp.NewAction(
 		[]cdp.Event{},
 		[]cdp.Command{
 			cdp.Command{ID: frame.RequestID.GetNext(), Method: indexeddb.CommandIndexedDBRequestDatabaseNames, Params: &indexeddb.RequestDatabaseNamesArgs{SecurityOrigin: securityOrigin}, Reply: &indexeddb.RequestDatabaseNamesReply{}, Timeout: timeout},
 		})
-	err := action.Run(frame)
+	err := action.RunContext(ctx, frame)
 	if err != nil {
-		frame.Browser.Log.Print(err)
+		frame.LogError(err)
 		return nil, err
 	}
 	return action.Commands[0].Reply.(*indexeddb.RequestDatabaseNamesReply), nil
@@ -23,14 +29,19 @@ func RequestDatabaseNames(frame *cdp.Frame, securityOrigin string, timeout time.
 
 // RequestDatabase returns the database with object stores.
 func RequestDatabase(frame *cdp.Frame, securityOrigin, databaseName string, timeout time.Duration) (*indexeddb.RequestDatabaseReply, error) {
+	return RequestDatabaseContext(context.Background(), frame, securityOrigin, databaseName, timeout)
+}
+
+// RequestDatabaseContext is like RequestDatabase but stops waiting on the browser once the context is done.
+func RequestDatabaseContext(ctx context.Context, frame *cdp.Frame, securityOrigin, databaseName string, timeout time.Duration) (*indexeddb.RequestDatabaseReply, error) {
 	action := cdp.NewAction(
 		[]cdp.Event{},
 		[]cdp.Command{
 			cdp.Command{ID: frame.RequestID.GetNext(), Method: indexeddb.CommandIndexedDBRequestDatabase, Params: &indexeddb.RequestDatabaseArgs{SecurityOrigin: securityOrigin, DatabaseName: databaseName}, Reply: &indexeddb.RequestDatabaseReply{}, Timeout: timeout},
 		})
-	err := action.Run(frame)
+	err := action.RunContext(ctx, frame)
 	if err != nil {
-		frame.Browser.Log.Print(err)
+		frame.LogError(err)
 		return nil, err
 	}
 	return action.Commands[0].Reply.(*indexeddb.RequestDatabaseReply), nil
@@ -38,6 +49,11 @@ func RequestDatabase(frame *cdp.Frame, securityOrigin, databaseName string, time
 
 // RequestData returns the requested data.
 func RequestData(frame *cdp.Frame, securityOrigin, databaseName, objectStoreName, indexName string, skipCount, pageSize int, keyRange *indexeddb.KeyRange, timeout time.Duration) (*indexeddb.RequestDataReply, error) {
+	return RequestDataContext(context.Background(), frame, securityOrigin, databaseName, objectStoreName, indexName, skipCount, pageSize, keyRange, timeout)
+}
+
+// RequestDataContext is like RequestData but stops waiting on the browser once the context is done.
+func RequestDataContext(ctx context.Context, frame *cdp.Frame, securityOrigin, databaseName, objectStoreName, indexName string, skipCount, pageSize int, keyRange *indexeddb.KeyRange, timeout time.Duration) (*indexeddb.RequestDataReply, error) {
 	args := &indexeddb.RequestDataArgs{
 		SecurityOrigin:  securityOrigin,
 		DatabaseName:    databaseName,
@@ -52,9 +68,9 @@ func RequestData(frame *cdp.Frame, securityOrigin, databaseName, objectStoreName
 		[]cdp.Command{
 			cdp.Command{ID: frame.RequestID.GetNext(), Method: indexeddb.CommandIndexedDBRequestData, Params: args, Reply: &indexeddb.RequestDataReply{}, Timeout: timeout},
 		})
-	err := action.Run(frame)
+	err := action.RunContext(ctx, frame)
 	if err != nil {
-		frame.Browser.Log.Print(err)
+		frame.LogError(err)
 		return nil, err
 	}
 	return action.Commands[0].Reply.(*indexeddb.RequestDataReply), nil
@@ -1,6 +1,7 @@
 package actions
 
 import (
+	"context"
 	"github.com/4ydx/cdp/protocol/dom"
 	"github.com/4ydx/cdp/protocol/input"
 	"github.com/4ydx/chrome-protocol"
@@ -30,7 +31,12 @@ func GetWindowsVirtualKeyCode(modifiers int) int {
 
 // Fill on the first element node that matches the find parameter.  dom.Focus can be called in order to focus an element in order to fill it.
 func Fill(frame *cdp.Frame, find, fill string, timeout time.Duration) error {
-	if err := Focus(frame, find, timeout); err != nil {
+	return FillContext(context.Background(), frame, find, fill, timeout)
+}
+
+// FillContext is like Fill but stops waiting on the browser once the context is done.
+func FillContext(ctx context.Context, frame *cdp.Frame, find, fill string, timeout time.Duration) error {
+	if err := FocusContext(ctx, frame, find, timeout); err != nil {
 		return err
 	}
 	for _, key := range fill {
@@ -38,9 +44,9 @@ func Fill(frame *cdp.Frame, find, fill string, timeout time.Duration) error {
 			[]cdp.Event{},
 			[]cdp.Command{
 				cdp.Command{ID: frame.RequestID.GetNext(), Method: input.CommandInputDispatchKeyEvent, Params: &input.DispatchKeyEventArgs{Type: "char", Text: string(key)}, Reply: &input.DispatchKeyEventReply{}, Timeout: timeout},
-			}).Run(frame)
+			}).RunContext(ctx, frame)
 		if err != nil {
-			frame.Browser.Log.Print(err)
+			frame.LogError(err)
 			return err
 		}
 	}
@@ -49,15 +55,25 @@ func Fill(frame *cdp.Frame, find, fill string, timeout time.Duration) error {
 
 // Clear clears out the value attribute of the found element.
 func Clear(frame *cdp.Frame, find string, timeout time.Duration) error {
-	nodeID, err := FindFirstElementNodeID(frame, find, timeout)
+	return ClearContext(context.Background(), frame, find, timeout)
+}
+
+// ClearContext is like Clear but stops waiting on the browser once the context is done.
+func ClearContext(ctx context.Context, frame *cdp.Frame, find string, timeout time.Duration) error {
+	nodeID, err := FindFirstElementNodeIDContext(ctx, frame, find, timeout)
 	if err != nil {
 		return err
 	}
-	return SetAttributeValue(frame, nodeID, "value", "", timeout)
+	return SetAttributeValueContext(ctx, frame, nodeID, "value", "", timeout)
 }
 
 // KeyDown sends a keydown request to the server.
 func KeyDown(frame *cdp.Frame, modifiers int, timeout time.Duration) error {
+	return KeyDownContext(context.Background(), frame, modifiers, timeout)
+}
+
+// KeyDownContext is like KeyDown but stops waiting on the browser once the context is done.
+func KeyDownContext(ctx context.Context, frame *cdp.Frame, modifiers int, timeout time.Duration) error {
 	windowsVirtualKeyCode := GetWindowsVirtualKeyCode(modifiers)
 	err := cdp.NewAction(
 		[]cdp.Event{},
@@ -67,9 +83,9 @@ func KeyDown(frame *cdp.Frame, modifiers int, timeout time.Duration) error {
 				Type:                  "keyDown",
 				WindowsVirtualKeyCode: windowsVirtualKeyCode,
 			}, Reply: &input.DispatchKeyEventReply{}, Timeout: timeout},
-		}).Run(frame)
+		}).RunContext(ctx, frame)
 	if err != nil {
-		frame.Browser.Log.Print(err)
+		frame.LogError(err)
 		return err
 	}
 	return nil
@@ -77,9 +93,14 @@ func KeyDown(frame *cdp.Frame, modifiers int, timeout time.Duration) error {
 
 // MouseScroll scrolls the mouse the given amount.
 func MouseScroll(frame *cdp.Frame, deltaX, deltaY float64, timeout time.Duration) error {
-	nodes, err := FindAll(frame, "body", timeout)
+	return MouseScrollContext(context.Background(), frame, deltaX, deltaY, timeout)
+}
+
+// MouseScrollContext is like MouseScroll but stops waiting on the browser once the context is done.
+func MouseScrollContext(ctx context.Context, frame *cdp.Frame, deltaX, deltaY float64, timeout time.Duration) error {
+	nodes, err := FindAllContext(ctx, frame, "body", timeout)
 	if err != nil {
-		frame.Browser.Log.Print(err)
+		frame.LogError(err)
 		return err
 	}
 	nodeID := dom.NodeID(0)
@@ -93,9 +114,9 @@ func MouseScroll(frame *cdp.Frame, deltaX, deltaY float64, timeout time.Duration
 		[]cdp.Command{
 			cdp.Command{ID: frame.RequestID.GetNext(), Method: dom.CommandDOMGetBoxModel, Params: &dom.GetBoxModelArgs{NodeID: nodeID}, Reply: &dom.GetBoxModelReply{}, Timeout: timeout},
 		})
-	err = a0.Run(frame)
+	err = a0.RunContext(ctx, frame)
 	if err != nil {
-		frame.Browser.Log.Print(err)
+		frame.LogError(err)
 		return err
 	}
 
@@ -126,9 +147,9 @@ func MouseScroll(frame *cdp.Frame, deltaX, deltaY float64, timeout time.Duration
 				DeltaX:     deltaX,
 				DeltaY:     deltaY,
 			}, Reply: &input.DispatchMouseEventReply{}, Timeout: timeout},
-		}).Run(frame)
+		}).RunContext(ctx, frame)
 	if err != nil {
-		frame.Browser.Log.Print(err)
+		frame.LogError(err)
 		return err
 	}
 	return nil
@@ -10,9 +10,15 @@ import (
 func TestFill(t *testing.T) {
 	srv := LocalServer()
 
-	browser := cdp.NewBrowser(BrowserPath, 9222, "input_test.log")
+	browser, err := cdp.NewBrowser(BrowserPath, 0, "input_test.log")
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	frame := cdp.Start(browser, cdp.LogBasic)
+	frame, err := cdp.Start(browser, cdp.LogBasic)
+	if err != nil {
+		t.Fatal(err)
+	}
 	defer frame.Stop(true)
 
 	// Enable page and dom events
@@ -1,6 +1,7 @@
 package actions
 
 import (
+	"context"
 	"github.com/4ydx/cdp/protocol"
 	"github.com/4ydx/cdp/protocol/network"
 	"github.com/4ydx/chrome-protocol"
@@ -10,20 +11,30 @@ import (
 
 // Cookies gets the browser's current cookies.
 func Cookies(frame *cdp.Frame, timeout time.Duration) ([]network.Cookie, error) {
+	return CookiesContext(context.Background(), frame, timeout)
+}
+
+// CookiesContext is like Cookies but stops waiting on the browser once the context is done.
+func CookiesContext(ctx context.Context, frame *cdp.Frame, timeout time.Duration) ([]network.Cookie, error) {
 	action := cdp.NewAction(
 		[]cdp.Event{},
 		[]cdp.Command{
 			cdp.Command{ID: frame.RequestID.GetNext(), Method: network.CommandNetworkGetCookies, Params: &network.GetAllCookiesArgs{}, Reply: &network.GetAllCookiesReply{}, Timeout: timeout},
 		})
-	err := action.Run(frame)
+	err := action.RunContext(ctx, frame)
 	if err != nil {
-		frame.Browser.Log.Print(err)
+		frame.LogError(err)
 	}
 	return action.Commands[0].Reply.(*network.GetAllCookiesReply).Cookies, err
 }
 
 // SetCookie sets one cookie in the browser.
 func SetCookie(frame *cdp.Frame, url string, cookie *http.Cookie, timeout time.Duration) (bool, error) {
+	return SetCookieContext(context.Background(), frame, url, cookie, timeout)
+}
+
+// SetCookieContext is like SetCookie but stops waiting on the browser once the context is done.
+func SetCookieContext(ctx context.Context, frame *cdp.Frame, url string, cookie *http.Cookie, timeout time.Duration) (bool, error) {
 	tse := shared.TimeSinceEpoch(float64(cookie.Expires.Unix()))
 	params := &network.SetCookieArgs{
 		URL:      url,
@@ -40,9 +51,9 @@ func SetCookie(frame *cdp.Frame, url string, cookie *http.Cookie, timeout time.D
 		[]cdp.Command{
 			cdp.Command{ID: frame.RequestID.GetNext(), Method: network.CommandNetworkSetCookie, Params: params, Reply: &network.SetCookieReply{}, Timeout: timeout},
 		})
-	err := action.Run(frame)
+	err := action.RunContext(ctx, frame)
 	if err != nil {
-		frame.Browser.Log.Print(err)
+		frame.LogError(err)
 	}
 	return action.Commands[0].Reply.(*network.SetCookieReply).Success, err
 }
@@ -7,9 +7,15 @@ import (
 )
 
 func TestCookies(t *testing.T) {
-	browser := cdp.NewBrowser(BrowserPath, 9222, "page_test.log")
+	browser, err := cdp.NewBrowser(BrowserPath, 0, "page_test.log")
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	frame := cdp.Start(browser, cdp.LogBasic)
+	frame, err := cdp.Start(browser, cdp.LogBasic)
+	if err != nil {
+		t.Fatal(err)
+	}
 	defer frame.Stop(true)
 
 	// Enable page events
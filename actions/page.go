@@ -2,7 +2,8 @@ package actions
 
 import (
 	"bytes"
-	"errors"
+	"context"
+	"fmt"
 	"github.com/4ydx/cdp/protocol/page"
 	"github.com/4ydx/chrome-protocol"
 	"image"
@@ -37,26 +38,36 @@ func GetNavigationEvents() []cdp.Event {
 
 // Navigate sends the browser to the given URL
 func Navigate(frame *cdp.Frame, url string, timeout time.Duration) ([]cdp.Event, error) {
+	return NavigateContext(context.Background(), frame, url, timeout)
+}
+
+// NavigateContext is like Navigate but stops waiting on the browser once the context is done.
+func NavigateContext(ctx context.Context, frame *cdp.Frame, url string, timeout time.Duration) ([]cdp.Event, error) {
 	events := GetNavigationEvents()
 	action := cdp.NewAction(
 		events,
 		[]cdp.Command{
 			cdp.Command{ID: frame.RequestID.GetNext(), Method: page.CommandPageNavigate, Params: &page.NavigateArgs{URL: url}, Reply: &page.NavigateReply{}, Timeout: timeout},
 		})
-	err := action.Run(frame)
+	err := action.RunContext(ctx, frame)
 	if err != nil {
-		frame.Browser.Log.Print(err)
+		frame.LogError(err)
 	}
 	if action.Commands[0].Reply.(*page.NavigateReply).ErrorText != "" {
-		err := action.Commands[0].Reply.(*page.NavigateReply).ErrorText
-		frame.Browser.Log.Print(err)
-		return events, errors.New(err)
+		err := fmt.Errorf("%w: %s", cdp.ErrNavigationFailed, action.Commands[0].Reply.(*page.NavigateReply).ErrorText)
+		frame.LogError(err)
+		return action.GetEvents(), err
 	}
-	return events, err
+	return action.GetEvents(), err
 }
 
 // Screenshot captures a screenshot and saves it to the given destination.
 func Screenshot(frame *cdp.Frame, destination, format string, quality int, clip *page.Viewport, timeout time.Duration) (err error) {
+	return ScreenshotContext(context.Background(), frame, destination, format, quality, clip, timeout)
+}
+
+// ScreenshotContext is like Screenshot but stops waiting on the browser once the context is done.
+func ScreenshotContext(ctx context.Context, frame *cdp.Frame, destination, format string, quality int, clip *page.Viewport, timeout time.Duration) (err error) {
 	var action *cdp.Action
 	if clip != nil {
 		action = cdp.NewAction(
@@ -71,8 +82,8 @@ func Screenshot(frame *cdp.Frame, destination, format string, quality int, clip
 				cdp.Command{ID: frame.RequestID.GetNext(), Method: page.CommandPageCaptureScreenshot, Params: &page.CaptureScreenshotArgs{Format: format, Quality: quality}, Reply: &page.CaptureScreenshotReply{}, Timeout: timeout},
 			})
 	}
-	if err = action.Run(frame); err != nil {
-		frame.Browser.Log.Print(err)
+	if err = action.RunContext(ctx, frame); err != nil {
+		frame.LogError(err)
 		return err
 	}
 
@@ -80,7 +91,7 @@ func Screenshot(frame *cdp.Frame, destination, format string, quality int, clip
 	src := action.Commands[0].Reply.(*page.CaptureScreenshotReply).Data
 	m, _, err := image.Decode(bytes.NewReader(src))
 	if err != nil {
-		frame.Browser.Log.Print(err)
+		frame.LogError(err)
 		return err
 	}
 
@@ -90,7 +101,7 @@ func Screenshot(frame *cdp.Frame, destination, format string, quality int, clip
 	}
 	f, err := os.Create(destination)
 	if err != nil {
-		frame.Browser.Log.Print(err)
+		frame.LogError(err)
 		return err
 	}
 	defer func() {
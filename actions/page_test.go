@@ -1,17 +1,25 @@
 package actions
 
 import (
+	"errors"
 	"github.com/4ydx/cdp/protocol/page"
 	"github.com/4ydx/chrome-protocol"
+	"github.com/4ydx/chrome-protocol/cdptest"
 	"os"
 	"testing"
 	"time"
 )
 
 func TestNavigate(t *testing.T) {
-	browser := cdp.NewBrowser(BrowserPath, 9222, "page_test.log")
+	browser, err := cdp.NewBrowser(BrowserPath, 0, "page_test.log")
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	frame := cdp.Start(browser, cdp.LogBasic)
+	frame, err := cdp.Start(browser, cdp.LogBasic)
+	if err != nil {
+		t.Fatal(err)
+	}
 	defer frame.Stop(true)
 
 	// Enable page events
@@ -32,9 +40,15 @@ func TestNavigate(t *testing.T) {
 }
 
 func TestScreenshot(t *testing.T) {
-	browser := cdp.NewBrowser(BrowserPath, 9222, "page_test.log")
+	browser, err := cdp.NewBrowser(BrowserPath, 0, "page_test.log")
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	frame := cdp.Start(browser, cdp.LogBasic)
+	frame, err := cdp.Start(browser, cdp.LogBasic)
+	if err != nil {
+		t.Fatal(err)
+	}
 	defer frame.Stop(true)
 
 	// Enable page events
@@ -51,9 +65,52 @@ func TestScreenshot(t *testing.T) {
 	if err := Screenshot(frame, "google", "png", 100, nil, time.Second*5); err != nil {
 		t.Fatal(err)
 	}
-	_, err := os.Stat("google.png")
+	_, err = os.Stat("google.png")
 	if err != nil {
 		t.Fatal(err)
 	}
 	t.Logf("All completed for %s", frame.FrameID)
 }
+
+func TestNavigateFake(t *testing.T) {
+	server := cdptest.NewServer()
+	defer server.Close()
+
+	server.Reply(page.CommandPageNavigate, map[string]string{"frameId": "F1", "loaderId": "L1"},
+		cdptest.Event{Method: page.EventPageFrameStartedLoading, Params: map[string]string{"frameId": "F1"}},
+		cdptest.Event{Method: page.EventPageFrameNavigated, Params: map[string]interface{}{"frame": map[string]string{"id": "F1", "url": "https://example.com/"}}},
+		cdptest.Event{Method: page.EventPageFrameStoppedLoading, Params: map[string]string{"frameId": "F1"}},
+	)
+
+	frame, err := cdp.Start(server.Browser(), cdp.LogBasic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer frame.Stop(false)
+
+	events, err := Navigate(frame, "https://example.com/", time.Second*2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if url := GetFrameNavigatedURL(events); url != "https://example.com/" {
+		t.Fatalf("incorrect url %s", url)
+	}
+	received := server.Received()
+	if len(received) != 1 || string(received[0].Params) != `{"url":"https://example.com/"}` {
+		t.Fatalf("unexpected commands %+v", received)
+	}
+
+	// The browser reports a failed navigation without sending any navigation events.
+	server.Reply(page.CommandPageNavigate, map[string]string{"frameId": "F1", "errorText": "net::ERR_NAME_NOT_RESOLVED"})
+	if _, err := Navigate(frame, "https://missing.example.com/", time.Millisecond*100); !errors.Is(err, cdp.ErrNavigationFailed) {
+		t.Fatalf("expecting a failed navigation but got %v", err)
+	}
+
+	// The browser goes away while navigating.
+	server.Handle(page.CommandPageNavigate, func(m cdp.Message) cdptest.Response {
+		return cdptest.Response{Disconnect: true}
+	})
+	if _, err := Navigate(frame, "https://example.com/", time.Second*2); !errors.Is(err, cdp.ErrConnectionClosed) {
+		t.Fatalf("expecting a closed connection but got %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package actions
 
 import (
+	"context"
 	"github.com/4ydx/cdp/protocol"
 	"github.com/4ydx/cdp/protocol/runtime"
 	"github.com/4ydx/chrome-protocol"
@@ -9,14 +10,19 @@ import (
 
 // Evaluate runs the javascript expression in the current frame's context.
 func Evaluate(frame *cdp.Frame, expression string, timeout time.Duration) (*runtime.EvaluateReply, error) {
+	return EvaluateContext(context.Background(), frame, expression, timeout)
+}
+
+// EvaluateContext is like Evaluate but stops waiting on the browser once the context is done.
+func EvaluateContext(ctx context.Context, frame *cdp.Frame, expression string, timeout time.Duration) (*runtime.EvaluateReply, error) {
 	action := cdp.NewAction(
 		[]cdp.Event{},
 		[]cdp.Command{
 			cdp.Command{ID: frame.RequestID.GetNext(), Method: runtime.CommandRuntimeEvaluate, Params: &runtime.EvaluateArgs{Expression: expression, Silent: false}, Reply: &runtime.EvaluateReply{}, Timeout: timeout},
 		})
-	err := action.Run(frame)
+	err := action.RunContext(ctx, frame)
 	if err != nil {
-		frame.Browser.Log.Print(err)
+		frame.LogError(err)
 		return nil, err
 	}
 	return action.Commands[0].Reply.(*runtime.EvaluateReply), nil
@@ -24,6 +30,11 @@ func Evaluate(frame *cdp.Frame, expression string, timeout time.Duration) (*runt
 
 // GetProperties runs the properties of a given object.
 func GetProperties(frame *cdp.Frame, objectID shared.RemoteObjectID, ownProperties, accessorPropertiesOnly bool, timeout time.Duration) (*runtime.GetPropertiesReply, error) {
+	return GetPropertiesContext(context.Background(), frame, objectID, ownProperties, accessorPropertiesOnly, timeout)
+}
+
+// GetPropertiesContext is like GetProperties but stops waiting on the browser once the context is done.
+func GetPropertiesContext(ctx context.Context, frame *cdp.Frame, objectID shared.RemoteObjectID, ownProperties, accessorPropertiesOnly bool, timeout time.Duration) (*runtime.GetPropertiesReply, error) {
 	args := &runtime.GetPropertiesArgs{
 		ObjectID:               objectID,
 		OwnProperties:          ownProperties,
@@ -34,9 +45,9 @@ func GetProperties(frame *cdp.Frame, objectID shared.RemoteObjectID, ownProperti
 		[]cdp.Command{
 			cdp.Command{ID: frame.RequestID.GetNext(), Method: runtime.CommandRuntimeGetProperties, Params: args, Reply: &runtime.GetPropertiesReply{}, Timeout: timeout},
 		})
-	err := action.Run(frame)
+	err := action.RunContext(ctx, frame)
 	if err != nil {
-		frame.Browser.Log.Print(err)
+		frame.LogError(err)
 		return nil, err
 	}
 	return action.Commands[0].Reply.(*runtime.GetPropertiesReply), nil
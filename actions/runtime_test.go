@@ -1,15 +1,24 @@
 package actions
 
 import (
+	"errors"
+	"github.com/4ydx/cdp/protocol/runtime"
 	"github.com/4ydx/chrome-protocol"
+	"github.com/4ydx/chrome-protocol/cdptest"
 	"testing"
 	"time"
 )
 
 func TestEvaluate(t *testing.T) {
-	browser := cdp.NewBrowser(BrowserPath, 9222, "evaluate_test.log")
+	browser, err := cdp.NewBrowser(BrowserPath, 0, "evaluate_test.log")
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	frame := cdp.Start(browser, cdp.LogBasic)
+	frame, err := cdp.Start(browser, cdp.LogBasic)
+	if err != nil {
+		t.Fatal(err)
+	}
 	defer frame.Stop(true)
 
 	// Enable page events
@@ -33,3 +42,31 @@ func TestEvaluate(t *testing.T) {
 	}
 	t.Logf("All completed for %s", frame.FrameID)
 }
+
+func TestEvaluateFake(t *testing.T) {
+	server := cdptest.NewServer()
+	defer server.Close()
+
+	server.Reply(runtime.CommandRuntimeEvaluate, map[string]interface{}{"result": map[string]interface{}{"type": "number", "description": "2"}})
+
+	frame, err := cdp.Start(server.Browser(), cdp.LogBasic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer frame.Stop(false)
+
+	reply, err := Evaluate(frame, "1 + 1", time.Second*2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.Result.Type != "number" || reply.Result.Description != "2" {
+		t.Fatalf("unexpected result %+v", reply.Result)
+	}
+
+	server.Fail(runtime.CommandRuntimeEvaluate, -32000, "Cannot find context with specified id")
+	_, err = Evaluate(frame, "1 + 1", time.Second*2)
+	e := &cdp.Error{}
+	if !errors.As(err, &e) || e.Code != -32000 || e.Method != runtime.CommandRuntimeEvaluate {
+		t.Fatalf("expecting a protocol error but got %v", err)
+	}
+}
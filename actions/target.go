@@ -0,0 +1,128 @@
+package actions
+
+import (
+	"context"
+	"github.com/4ydx/cdp/protocol/target"
+	"github.com/4ydx/chrome-protocol"
+	"time"
+)
+
+// GetTargets lists the targets of the browser.  The frame should be connected with cdp.StartBrowser.
+func GetTargets(frame *cdp.Frame, timeout time.Duration) ([]target.Info, error) {
+	return GetTargetsContext(context.Background(), frame, timeout)
+}
+
+// GetTargetsContext is like GetTargets but stops waiting on the browser once the context is done.
+func GetTargetsContext(ctx context.Context, frame *cdp.Frame, timeout time.Duration) ([]target.Info, error) {
+	action := cdp.NewAction(
+		[]cdp.Event{},
+		[]cdp.Command{
+			cdp.Command{ID: frame.RequestID.GetNext(), Method: target.CommandTargetGetTargets, Params: &target.GetTargetsArgs{}, Reply: &target.GetTargetsReply{}, Timeout: timeout},
+		})
+	err := action.RunContext(ctx, frame)
+	if err != nil {
+		frame.LogError(err)
+		return nil, err
+	}
+	return action.Commands[0].Reply.(*target.GetTargetsReply).TargetInfos, nil
+}
+
+// CreateTarget opens a new page at the given url and returns the id of the page's target.
+func CreateTarget(frame *cdp.Frame, url string, timeout time.Duration) (target.ID, error) {
+	return CreateTargetContext(context.Background(), frame, url, timeout)
+}
+
+// CreateTargetContext is like CreateTarget but stops waiting on the browser once the context is done.
+func CreateTargetContext(ctx context.Context, frame *cdp.Frame, url string, timeout time.Duration) (target.ID, error) {
+	action := cdp.NewAction(
+		[]cdp.Event{},
+		[]cdp.Command{
+			cdp.Command{ID: frame.RequestID.GetNext(), Method: target.CommandTargetCreateTarget, Params: &target.CreateTargetArgs{URL: url}, Reply: &target.CreateTargetReply{}, Timeout: timeout},
+		})
+	err := action.RunContext(ctx, frame)
+	if err != nil {
+		frame.LogError(err)
+		return "", err
+	}
+	return action.Commands[0].Reply.(*target.CreateTargetReply).TargetID, nil
+}
+
+// AttachToTarget attaches to the target in flattened session mode.
+// The returned session Frame shares the frame's websocket and runs actions against the target.
+func AttachToTarget(frame *cdp.Frame, targetID target.ID, timeout time.Duration) (*cdp.Frame, error) {
+	return AttachToTargetContext(context.Background(), frame, targetID, timeout)
+}
+
+// AttachToTargetContext is like AttachToTarget but stops waiting on the browser once the context is done.
+func AttachToTargetContext(ctx context.Context, frame *cdp.Frame, targetID target.ID, timeout time.Duration) (*cdp.Frame, error) {
+	action := cdp.NewAction(
+		[]cdp.Event{},
+		[]cdp.Command{
+			cdp.Command{ID: frame.RequestID.GetNext(), Method: target.CommandTargetAttachToTarget, Params: &target.AttachToTargetArgs{TargetID: targetID, Flatten: true}, Reply: &target.AttachToTargetReply{}, Timeout: timeout},
+		})
+	err := action.RunContext(ctx, frame)
+	if err != nil {
+		frame.LogError(err)
+		return nil, err
+	}
+	sessionID := action.Commands[0].Reply.(*target.AttachToTargetReply).SessionID
+	return frame.NewSession(string(targetID), string(sessionID)), nil
+}
+
+// DetachFromTarget detaches the session from its target.  The session Frame can no longer be used.
+func DetachFromTarget(frame *cdp.Frame, session *cdp.Frame, timeout time.Duration) error {
+	return DetachFromTargetContext(context.Background(), frame, session, timeout)
+}
+
+// DetachFromTargetContext is like DetachFromTarget but stops waiting on the browser once the context is done.
+func DetachFromTargetContext(ctx context.Context, frame *cdp.Frame, session *cdp.Frame, timeout time.Duration) error {
+	err := cdp.NewAction(
+		[]cdp.Event{},
+		[]cdp.Command{
+			cdp.Command{ID: frame.RequestID.GetNext(), Method: target.CommandTargetDetachFromTarget, Params: &target.DetachFromTargetArgs{SessionID: target.SessionID(session.SessionID)}, Reply: &target.DetachFromTargetReply{}, Timeout: timeout},
+		}).RunContext(ctx, frame)
+	frame.RemoveSession(session.SessionID)
+	if err != nil {
+		frame.LogError(err)
+		return err
+	}
+	return nil
+}
+
+// ActivateTarget brings the target's page to the foreground.
+func ActivateTarget(frame *cdp.Frame, targetID target.ID, timeout time.Duration) error {
+	return ActivateTargetContext(context.Background(), frame, targetID, timeout)
+}
+
+// ActivateTargetContext is like ActivateTarget but stops waiting on the browser once the context is done.
+func ActivateTargetContext(ctx context.Context, frame *cdp.Frame, targetID target.ID, timeout time.Duration) error {
+	err := cdp.NewAction(
+		[]cdp.Event{},
+		[]cdp.Command{
+			cdp.Command{ID: frame.RequestID.GetNext(), Method: target.CommandTargetActivateTarget, Params: &target.ActivateTargetArgs{TargetID: targetID}, Reply: &target.ActivateTargetReply{}, Timeout: timeout},
+		}).RunContext(ctx, frame)
+	if err != nil {
+		frame.LogError(err)
+		return err
+	}
+	return nil
+}
+
+// CloseTarget closes the target's page.  Any session attached to the target is detached by the browser.
+func CloseTarget(frame *cdp.Frame, targetID target.ID, timeout time.Duration) error {
+	return CloseTargetContext(context.Background(), frame, targetID, timeout)
+}
+
+// CloseTargetContext is like CloseTarget but stops waiting on the browser once the context is done.
+func CloseTargetContext(ctx context.Context, frame *cdp.Frame, targetID target.ID, timeout time.Duration) error {
+	err := cdp.NewAction(
+		[]cdp.Event{},
+		[]cdp.Command{
+			cdp.Command{ID: frame.RequestID.GetNext(), Method: target.CommandTargetCloseTarget, Params: &target.CloseTargetArgs{TargetID: targetID}, Reply: &target.CloseTargetReply{}, Timeout: timeout},
+		}).RunContext(ctx, frame)
+	if err != nil {
+		frame.LogError(err)
+		return err
+	}
+	return nil
+}
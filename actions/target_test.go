@@ -0,0 +1,109 @@
+package actions
+
+import (
+	"github.com/4ydx/cdp/protocol/page"
+	"github.com/4ydx/cdp/protocol/target"
+	"github.com/4ydx/chrome-protocol"
+	"github.com/4ydx/chrome-protocol/cdptest"
+	"testing"
+	"time"
+)
+
+func TestTargets(t *testing.T) {
+	browser, err := cdp.NewBrowser(BrowserPath, 0, "target_test.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frame, err := cdp.StartBrowser(browser, cdp.LogBasic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer frame.Stop(true)
+
+	// Open two tabs that are driven over the same websocket.
+	first, err := CreateTarget(frame, "about:blank", time.Second*2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := CreateTarget(frame, "about:blank", time.Second*2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tab1, err := AttachToTarget(frame, first, time.Second*2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tab2, err := AttachToTarget(frame, second, time.Second*2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := EnablePage(tab1, time.Second*2); err != nil {
+		t.Fatal(err)
+	}
+	if err := EnablePage(tab2, time.Second*2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Navigate(tab1, "https://google.com", time.Second*10); err != nil {
+		t.Fatal(err)
+	}
+	if err := ActivateTarget(frame, second, time.Second*2); err != nil {
+		t.Fatal(err)
+	}
+
+	targets, err := GetTargets(frame, time.Second*2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := 0
+	for _, target := range targets {
+		if target.TargetID == first || target.TargetID == second {
+			found++
+		}
+	}
+	if found != 2 {
+		t.Fatalf("Expecting both created targets to be listed but found %d", found)
+	}
+
+	if err := CloseTarget(frame, second, time.Second*2); err != nil {
+		t.Fatal(err)
+	}
+	if err := DetachFromTarget(frame, tab1, time.Second*2); err != nil {
+		t.Fatal(err)
+	}
+	t.Logf("All completed for %s", tab1.FrameID)
+}
+
+func TestTargetsFake(t *testing.T) {
+	server := cdptest.NewServer()
+	defer server.Close()
+
+	server.Reply(target.CommandTargetCreateTarget, map[string]string{"targetId": "T1"})
+	server.Reply(target.CommandTargetAttachToTarget, map[string]string{"sessionId": "S1"})
+
+	frame, err := cdp.StartBrowser(server.Browser(), cdp.LogBasic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer frame.Stop(false)
+
+	id, err := CreateTarget(frame, "about:blank", time.Second*2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tab, err := AttachToTarget(frame, id, time.Second*2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := EnablePage(tab, time.Second*2); err != nil {
+		t.Fatal(err)
+	}
+
+	received := server.Received()
+	if len(received) != 3 {
+		t.Fatalf("unexpected commands %v", server.ReceivedMethods())
+	}
+	if received[2].Method != page.CommandPageEnable || received[2].SessionID != "S1" {
+		t.Fatalf("expecting the page to be enabled for the attached session but got %+v", received[2])
+	}
+}
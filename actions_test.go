@@ -0,0 +1,481 @@
+package cdp
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/4ydx/cdp/protocol/dom"
+	"github.com/4ydx/cdp/protocol/network"
+	"github.com/4ydx/cdp/protocol/page"
+	"github.com/gorilla/websocket"
+)
+
+// ServeChildNodes answers every command and follows each DOM.requestChildNodes reply with three DOM.setChildNodes events.
+// The returned function stops the frame and the server.
+func ServeChildNodes(t *testing.T) (*Frame, func()) {
+	srv, port := ServeCommands(t, func(c *websocket.Conn, m Message) {
+		if err := c.WriteJSON(map[string]interface{}{"id": m.ID, "result": map[string]string{}}); err != nil {
+			t.Error(err)
+		}
+		if m.Method != dom.CommandDOMRequestChildNodes {
+			return
+		}
+		for i := 1; i <= 3; i++ {
+			time.Sleep(time.Millisecond * 20)
+			if err := c.WriteJSON(map[string]interface{}{"method": dom.EventDOMSetChildNodes, "params": map[string]interface{}{"parentId": i, "nodes": []interface{}{}}}); err != nil {
+				t.Error(err)
+			}
+		}
+	})
+	frame, err := Start(NewTestBrowser(port), LogBasic)
+	if err != nil {
+		srv.Close()
+		t.Fatal(err)
+	}
+	return frame, func() {
+		frame.Stop(false)
+		srv.Close()
+	}
+}
+
+func childNodesAction(frame *Frame, event Event) *Action {
+	event.Name = dom.EventDOMSetChildNodes
+	event.Value = &dom.SetChildNodesReply{}
+	event.IsRequired = true
+	return NewAction(
+		[]Event{event},
+		[]Command{
+			Command{ID: frame.RequestID.GetNext(), Method: dom.CommandDOMRequestChildNodes, Params: &dom.RequestChildNodesArgs{NodeID: 1, Depth: -1}, Reply: &dom.RequestChildNodesReply{}, Timeout: time.Millisecond * 500},
+		})
+}
+
+func TestEventCount(t *testing.T) {
+	frame, stop := ServeChildNodes(t)
+	defer stop()
+
+	act := childNodesAction(frame, Event{Count: 3, Collect: true})
+	if err := act.Run(frame); err != nil {
+		t.Fatal(err)
+	}
+	e := act.Events[dom.EventDOMSetChildNodes]
+	if e.Found != 3 || len(e.Values) != 3 {
+		t.Fatalf("Expecting three occurrences to be collected but got %+v", e)
+	}
+	if e.Values[0] != e.Value {
+		t.Fatal("Expecting the first occurrence to be unmarshaled into the event's value")
+	}
+	for i, v := range e.Values {
+		if parent := v.(*dom.SetChildNodesReply).ParentID; parent != dom.NodeID(i+1) {
+			t.Fatalf("Expecting occurrence %d to have parent %d but got %d", i, i+1, parent)
+		}
+	}
+
+	err := childNodesAction(frame, Event{Count: 4}).Run(frame)
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("Expecting a timeout while waiting on a fourth occurrence but got %v", err)
+	}
+}
+
+func TestEventQuiet(t *testing.T) {
+	frame, stop := ServeChildNodes(t)
+	defer stop()
+
+	start := time.Now()
+	act := childNodesAction(frame, Event{Quiet: time.Millisecond * 100, Collect: true})
+	if err := act.Run(frame); err != nil {
+		t.Fatal(err)
+	}
+	if e := act.Events[dom.EventDOMSetChildNodes]; len(e.Values) != 3 {
+		t.Fatalf("Expecting every occurrence before the quiet period to be collected but got %+v", e)
+	}
+	if elapsed := time.Since(start); elapsed < time.Millisecond*160 {
+		t.Fatalf("Expecting the action to wait for the quiet period after the last occurrence but it returned after %s", elapsed)
+	}
+
+	// An event that never occurs is quiet once the period has passed.
+	act = NewAction(
+		[]Event{
+			Event{Name: dom.EventDOMSetChildNodes, Value: &dom.SetChildNodesReply{}, IsRequired: true, Quiet: time.Millisecond * 50},
+		},
+		[]Command{
+			Command{ID: frame.RequestID.GetNext(), Method: page.CommandPageBringToFront, Params: &page.BringToFrontArgs{}, Reply: &page.BringToFrontReply{}, Timeout: time.Millisecond * 500},
+		})
+	if err := act.Run(frame); err != nil {
+		t.Fatal(err)
+	}
+	if e := act.Events[dom.EventDOMSetChildNodes]; e.Found != 0 {
+		t.Fatalf("Expecting no occurrences but got %+v", e)
+	}
+}
+
+func TestEventMatch(t *testing.T) {
+	srv, port := ServeCommands(t, func(c *websocket.Conn, m Message) {
+		if err := c.WriteJSON(map[string]interface{}{"id": m.ID, "result": map[string]string{}}); err != nil {
+			t.Error(err)
+		}
+		for _, url := range []string{"https://example.com/app.js", "https://example.com/api/login", "https://example.com/api/logout"} {
+			if err := c.WriteJSON(map[string]interface{}{"method": network.EventNetworkResponseReceived, "params": map[string]interface{}{"requestId": url, "response": map[string]string{"url": url}}}); err != nil {
+				t.Error(err)
+			}
+		}
+	})
+	defer srv.Close()
+
+	frame, err := Start(NewTestBrowser(port), LogBasic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer frame.Stop(false)
+
+	login := &network.ResponseReceivedReply{}
+	act := NewAction(
+		[]Event{
+			Event{Name: network.EventNetworkResponseReceived, Value: login, IsRequired: true, Match: func(value CommandReply) bool {
+				// The predicate may use the frame since it does not run under the frame's lock.
+				if frame.GetFrameID() != "" {
+					return false
+				}
+				return strings.HasSuffix(value.(*network.ResponseReceivedReply).Response.URL, "/api/login")
+			}},
+		},
+		[]Command{
+			Command{ID: frame.RequestID.GetNext(), Method: network.CommandNetworkEnable, Params: &network.EnableArgs{}, Reply: &network.EnableReply{}, Timeout: time.Second * 2},
+		})
+	if err := act.Run(frame); err != nil {
+		t.Fatal(err)
+	}
+	// The other responses do not match so neither may replace the value.
+	time.Sleep(time.Millisecond * 50)
+	if login.Response.URL != "https://example.com/api/login" {
+		t.Fatalf("Expecting the value of the matching occurrence but got %s", login.Response.URL)
+	}
+	if e := act.GetEvents()[0]; !e.IsFound || e.Found != 1 {
+		t.Fatalf("Expecting one matching occurrence but got %+v", e)
+	}
+}
+
+func TestCommandBuild(t *testing.T) {
+	var mu sync.Mutex
+	worlds := []string{}
+	srv, port := ServeCommands(t, func(c *websocket.Conn, m Message) {
+		result := map[string]string{}
+		switch m.Method {
+		case page.CommandPageNavigate:
+			result = map[string]string{"frameId": "F1", "loaderId": "L1"}
+		case page.CommandPageCreateIsolatedWorld:
+			mu.Lock()
+			worlds = append(worlds, string(m.Params))
+			mu.Unlock()
+		}
+		if err := c.WriteJSON(map[string]interface{}{"id": m.ID, "result": result}); err != nil {
+			t.Error(err)
+		}
+	})
+	defer srv.Close()
+
+	frame, err := Start(NewTestBrowser(port), LogBasic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer frame.Stop(false)
+
+	// Build may use the frame since it does not run under the frame's lock.
+	err = NewAction(
+		[]Event{},
+		[]Command{
+			Command{ID: frame.RequestID.GetNext(), Method: page.CommandPageNavigate, Params: &page.NavigateArgs{URL: "http://localhost/"}, Reply: &page.NavigateReply{}, Timeout: time.Second},
+			Command{ID: frame.RequestID.GetNext(), Method: page.CommandPageCreateIsolatedWorld, Reply: &page.CreateIsolatedWorldReply{}, Timeout: time.Second,
+				Build: func(previous []Command) (json.Marshaler, error) {
+					if frame.GetFrameID() != string(previous[0].Reply.(*page.NavigateReply).FrameID) {
+						return nil, errors.New("the frame id does not match the navigate reply")
+					}
+					return &page.CreateIsolatedWorldArgs{FrameID: previous[0].Reply.(*page.NavigateReply).FrameID, WorldName: "built"}, nil
+				}},
+		}).Run(frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(worlds) != 1 || worlds[0] != `{"frameId":"F1","worldName":"built"}` {
+		t.Fatalf("Expecting the built params to be sent but got %q", worlds)
+	}
+}
+
+func TestEventGroup(t *testing.T) {
+	srv, port := ServeCommands(t, func(c *websocket.Conn, m Message) {
+		if err := c.WriteJSON(map[string]interface{}{"id": m.ID, "result": map[string]string{}}); err != nil {
+			t.Error(err)
+		}
+		if err := c.WriteJSON(map[string]interface{}{"method": page.EventPageNavigatedWithinDocument, "params": map[string]string{"frameId": "F1", "url": "https://example.com/#b"}}); err != nil {
+			t.Error(err)
+		}
+	})
+	defer srv.Close()
+
+	frame, err := Start(NewTestBrowser(port), LogBasic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer frame.Stop(false)
+
+	act := NewAction(
+		[]Event{
+			Event{Name: page.EventPageFrameNavigated, Value: &page.FrameNavigatedReply{}, IsRequired: true, Group: "navigation"},
+			Event{Name: page.EventPageNavigatedWithinDocument, Value: &page.NavigatedWithinDocumentReply{}, IsRequired: true, Group: "navigation"},
+		},
+		[]Command{
+			Command{ID: frame.RequestID.GetNext(), Method: page.CommandPageBringToFront, Params: &page.BringToFrontArgs{}, Reply: &page.BringToFrontReply{}, Timeout: time.Second * 2},
+		})
+	if err := act.Run(frame); err != nil {
+		t.Fatal(err)
+	}
+	e, ok := FirstFound(act.GetEvents(), "navigation")
+	if !ok || e.Name != page.EventPageNavigatedWithinDocument {
+		t.Fatalf("Expecting the navigation within the document to be found but got %+v", act.GetEvents())
+	}
+
+	// A group with no found event keeps the action waiting.
+	act = NewAction(
+		[]Event{
+			Event{Name: page.EventPageFrameNavigated, Value: &page.FrameNavigatedReply{}, IsRequired: true, Group: "navigation"},
+			Event{Name: page.EventPageLoadEventFired, Value: &page.LoadEventFiredReply{}, IsRequired: true, Group: "navigation"},
+		},
+		[]Command{
+			Command{ID: frame.RequestID.GetNext(), Method: page.CommandPageBringToFront, Params: &page.BringToFrontArgs{}, Reply: &page.BringToFrontReply{}, Timeout: time.Millisecond * 200},
+		})
+	if err := act.Run(frame); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("Expecting a timeout but got %v", err)
+	}
+}
+
+func TestActionTimeouts(t *testing.T) {
+	srv, port := ServeCommands(t, func(c *websocket.Conn, m Message) {
+		if m.Method == page.CommandPageStopLoading {
+			// Never answered.
+			return
+		}
+		time.Sleep(time.Millisecond * 40)
+		if err := c.WriteJSON(map[string]interface{}{"id": m.ID, "result": map[string]string{}}); err != nil {
+			t.Error(err)
+		}
+	})
+	defer srv.Close()
+
+	frame, err := Start(NewTestBrowser(port), LogBasic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer frame.Stop(false)
+
+	bringToFront := func(timeout time.Duration) Command {
+		return Command{ID: frame.RequestID.GetNext(), Method: page.CommandPageBringToFront, Params: &page.BringToFrontArgs{}, Reply: &page.BringToFrontReply{}, Timeout: timeout}
+	}
+	phase := func(err error) string {
+		e := &TimeoutError{}
+		if !errors.As(err, &e) || !errors.Is(err, ErrTimeout) {
+			t.Fatalf("Expecting a timeout error but got %v", err)
+		}
+		return e.Phase
+	}
+
+	// Every command replies within its own timeout but together they take longer than the action may.
+	act := NewAction([]Event{}, []Command{bringToFront(time.Second), bringToFront(time.Second), bringToFront(time.Second), bringToFront(time.Second)})
+	act.Timeout = time.Millisecond * 100
+	start := time.Now()
+	if p := phase(act.Run(frame)); p != PhaseAction {
+		t.Fatalf("Expecting the action phase to expire but got %s", p)
+	}
+	if elapsed := time.Since(start); elapsed > time.Millisecond*500 {
+		t.Fatalf("Expecting the action deadline to end the action but it took %s", elapsed)
+	}
+
+	// The required event never arrives.
+	act = NewAction(
+		[]Event{
+			Event{Name: page.EventPageLoadEventFired, Value: &page.LoadEventFiredReply{}, IsRequired: true},
+		},
+		[]Command{bringToFront(time.Second * 5)})
+	act.EventTimeout = time.Millisecond * 50
+	start = time.Now()
+	err = act.Run(frame)
+	if p := phase(err); p != PhaseEvents {
+		t.Fatalf("Expecting the events phase to expire but got %s", p)
+	}
+	if e := err.(*TimeoutError); len(e.Missing) != 1 || e.Missing[0] != page.EventPageLoadEventFired || e.Timeout != act.EventTimeout {
+		t.Fatalf("Expecting the missing event to be reported but got %+v", e)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Expecting the event timeout to end the action but it took %s", elapsed)
+	}
+
+	act = NewAction([]Event{}, []Command{
+		bringToFront(time.Second),
+		Command{ID: frame.RequestID.GetNext(), Method: page.CommandPageStopLoading, Params: &page.StopLoadingArgs{}, Reply: &page.StopLoadingReply{}, Timeout: time.Millisecond * 50},
+	})
+	err = act.Run(frame)
+	if p := phase(err); p != PhaseCommand {
+		t.Fatalf("Expecting the command phase to expire but got %s", p)
+	}
+	if e := err.(*TimeoutError); e.Method != page.CommandPageStopLoading {
+		t.Fatalf("Expecting the unanswered command to be reported but got %+v", e)
+	}
+}
+
+func TestTimeoutDiagnostics(t *testing.T) {
+	srv, port := ServeCommands(t, func(c *websocket.Conn, m Message) {
+		if err := c.WriteJSON(map[string]interface{}{"id": m.ID, "result": map[string]string{"frameId": "F1", "loaderId": "L1"}}); err != nil {
+			t.Error(err)
+		}
+		if err := c.WriteJSON(map[string]interface{}{"method": page.EventPageFrameStartedLoading, "params": map[string]string{"frameId": "F1"}}); err != nil {
+			t.Error(err)
+		}
+	})
+	defer srv.Close()
+
+	size := MessageHistory
+	MessageHistory = 2
+	defer func() { MessageHistory = size }()
+
+	frame, err := Start(NewTestBrowser(port), LogBasic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer frame.Stop(false)
+
+	act := NewAction(
+		[]Event{
+			// The group is done once the started loading event arrives so its other event is not missing.
+			Event{Name: page.EventPageFrameStartedLoading, Value: &page.FrameStartedLoadingReply{}, IsRequired: true, Group: "start"},
+			Event{Name: page.EventPageLoadEventFired, Value: &page.LoadEventFiredReply{}, IsRequired: true, Group: "start"},
+			Event{Name: page.EventPageFrameStoppedLoading, Value: &page.FrameStoppedLoadingReply{}, IsRequired: true},
+		},
+		[]Command{
+			Command{ID: frame.RequestID.GetNext(), Method: page.CommandPageNavigate, Params: &page.NavigateArgs{URL: "http://localhost/a"}, Reply: &page.NavigateReply{}, Timeout: time.Second * 5},
+		})
+	act.EventTimeout = time.Millisecond * 100
+	err = act.Run(frame)
+	e := &TimeoutError{}
+	if !errors.As(err, &e) {
+		t.Fatalf("Expecting a timeout error but got %v", err)
+	}
+	if e.Phase != PhaseEvents || e.Timeout != act.EventTimeout || e.CommandIndex != 1 || e.Commands != 1 || e.Elapsed < time.Millisecond*100 {
+		t.Fatalf("Unexpected timeout state %+v", e)
+	}
+	if len(e.Missing) != 1 || e.Missing[0] != page.EventPageFrameStoppedLoading || len(e.Matched) != 1 || e.Matched[0] != page.EventPageFrameStartedLoading {
+		t.Fatalf("Expecting the stopped loading event to be missing and the started loading event to be matched but got %+v", e)
+	}
+	if len(e.Messages) != 2 || !strings.Contains(string(e.Messages[0]), `"id"`) || !strings.Contains(string(e.Messages[1]), page.EventPageFrameStartedLoading) {
+		t.Fatalf("Expecting the reply and the event to be kept but got %s", e.Messages)
+	}
+	if !strings.Contains(err.Error(), "waiting on "+page.EventPageFrameStoppedLoading) || !strings.Contains(e.Diagnostics(), page.EventPageFrameStartedLoading) {
+		t.Fatalf("Unexpected error text %s", e.Diagnostics())
+	}
+}
+
+func TestLateReplies(t *testing.T) {
+	var mu sync.Mutex
+	var late, lastID int64
+	write := func(c *websocket.Conn, v interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err := c.WriteJSON(v); err != nil {
+			t.Error(err)
+		}
+	}
+	lateReply := func(c *websocket.Conn, id int64) {
+		write(c, map[string]interface{}{"id": id, "result": map[string]string{}})
+		for i := 0; i < 3; i++ {
+			write(c, map[string]interface{}{"method": page.EventPageFrameStoppedLoading, "params": map[string]string{"frameId": "F1"}})
+		}
+	}
+	srv, port := ServeCommands(t, func(c *websocket.Conn, m Message) {
+		switch m.Method {
+		case page.CommandPageBringToFront:
+			// Replies arrive long after their actions timed out, along with events for a subscription that never keeps up.
+			atomic.StoreInt64(&lastID, m.ID)
+			go func() {
+				time.Sleep(time.Millisecond * 50)
+				lateReply(c, m.ID)
+				atomic.AddInt64(&late, 1)
+			}()
+			return
+		case page.CommandPageStopLoading:
+			// The reply follows one more late reply and more events than the subscription queues.
+			lateReply(c, atomic.LoadInt64(&lastID))
+		}
+		write(c, map[string]interface{}{"id": m.ID, "result": map[string]string{}})
+	})
+	defer srv.Close()
+
+	frame, err := Start(NewTestBrowser(port), LogBasic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame.QueueSize = 1
+	release := make(chan struct{})
+	defer close(release)
+	sub := frame.On(page.EventPageFrameStoppedLoading, func(value json.Unmarshaler) {
+		<-release
+	})
+
+	bringToFront := func() Command {
+		return Command{ID: frame.RequestID.GetNext(), Method: page.CommandPageBringToFront, Params: &page.BringToFrontArgs{}, Reply: &page.BringToFrontReply{}, Timeout: time.Millisecond * 10}
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := NewAction([]Event{}, []Command{bringToFront(), bringToFront()}).Run(frame)
+			if !errors.Is(err, ErrTimeout) {
+				t.Errorf("Expecting a timeout but got %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	until := time.Now().Add(time.Second * 5)
+	for atomic.LoadInt64(&late) < 100 && time.Now().Before(until) {
+		time.Sleep(time.Millisecond)
+	}
+
+	// The read loop keeps going after the late replies and the dropped events.
+	// The first command waits for the read loop to work through the messages of the timed out actions.
+	// The second one measures how long a late reply and dropped events hold up the reply that follows them.
+	stopLoading := func() error {
+		return NewAction([]Event{}, []Command{
+			Command{ID: frame.RequestID.GetNext(), Method: page.CommandPageStopLoading, Params: &page.StopLoadingArgs{}, Reply: &page.StopLoadingReply{}, Timeout: time.Second * 5},
+		}).Run(frame)
+	}
+	if err := stopLoading(); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if err := stopLoading(); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Millisecond*500 {
+		t.Fatalf("Expecting a prompt reply but it took %s", elapsed)
+	}
+	frame.RLock()
+	actions, pending := len(frame.Actions), len(frame.Pending)
+	frame.RUnlock()
+	if actions != 0 || pending != 0 {
+		t.Fatalf("Expecting no active actions but got %d actions and %d pending commands", actions, pending)
+	}
+	if sub.Dropped() == 0 {
+		t.Fatal("Expecting the slow subscription to drop events")
+	}
+
+	// Once the write loop has returned new actions fail instead of waiting on it.
+	frame.Stop(false)
+	err = NewAction([]Event{}, []Command{bringToFront()}).Run(frame)
+	if !errors.Is(err, ErrConnectionClosed) {
+		t.Fatalf("Expecting a closed connection but got %v", err)
+	}
+}
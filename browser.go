@@ -5,132 +5,499 @@ import (
 	"fmt"
 	"io/ioutil"
 	"log"
+	"net/url"
 	"os"
 	"os/exec"
-	"sort"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
+
+	"github.com/4ydx/cdp/protocol/browser"
+	"github.com/gorilla/websocket"
 )
 
+// StartupTimeout is how long NewBrowser waits for the browser to begin listening for devtools connections.
+var StartupTimeout = time.Second * 10
+
 // Browser contains information required to stop an exec'd browser at a later point in time.
 type Browser struct {
-	Port        int
-	PID         int
-	TempDir     string
-	LogFile     *os.File
-	Log         *log.Logger
-	ConsoleFile *os.File
-	Console     *log.Logger
+	Port         int
+	PID          int
+	TempDir      string
+	WebSocketURL string // The browser target's websocket url announced by the browser once it is ready.
+	LogFile      *os.File
+	Log          *log.Logger
+	ConsoleFile  *os.File
+	Console      *log.Logger
+
+	// Logger receives the browser's records.  NewBrowser writes them to Log unless LaunchOptions.Logger is set.
+	Logger Logger
+
+	// keepDir is set when TempDir is a reused profile that must outlive the browser.
+	keepDir bool
+
+	// files are the log files that NewBrowserWithOptions created.  cleanup closes them.
+	files []*os.File
+
+	// exited is closed once the browser process has exited and exitErr is set.
+	exited  chan struct{}
+	exitErr error
+
+	// pipe is the transport of a browser launched with LaunchOptions.Pipe.
+	pipe *PipeTransport
+
+	// stopOnce makes Stop shut the browser down once.  stopErr keeps the result for later calls.
+	stopOnce sync.Once
+	stopErr  error
 }
 
 // NewBrowser accepts the path to the browser's binary, the port, and any arguments that need to be passed to the binary.
-func NewBrowser(path string, port int, logfile string, args ...string) *Browser {
-	b := &Browser{}
+// A port of 0 lets the browser pick a free port, which is then read back from the DevToolsActivePort file in TempDir and stored in Port.
+// This allows any number of browsers to run side by side.
+func NewBrowser(path string, port int, logfile string, args ...string) (*Browser, error) {
+	return NewBrowserWithOptions(LaunchOptions{Path: path, Port: port, LogFile: logfile, Flags: args})
+}
 
+// NewBrowserWithOptions starts the browser described by the options and waits until it accepts devtools connections.
+func NewBrowserWithOptions(opts LaunchOptions) (*Browser, error) {
+	b := &Browser{Logger: opts.Logger}
+
+	// The records go to a supplied Logger, so the log files are then only created when LogFile asks for them.
 	var err error
-	b.LogFile, err = os.Create(logfile)
-	if err != nil {
-		panic(err)
-	}
-	b.Log = log.New(b.LogFile, "", log.Llongfile|log.LstdFlags|log.Lmicroseconds)
+	if opts.Logger == nil || opts.LogFile != "" {
+		logfile := opts.LogFile
+		if logfile == "" {
+			logfile = "browser.log"
+		}
+		b.LogFile, err = os.Create(logfile)
+		if err != nil {
+			return nil, err
+		}
+		b.files = append(b.files, b.LogFile)
+		b.Log = log.New(b.LogFile, "", log.Llongfile|log.LstdFlags|log.Lmicroseconds)
 
-	b.ConsoleFile, err = os.Create(logfile + ".console")
-	if err != nil {
-		panic(err)
+		b.ConsoleFile, err = os.Create(logfile + ".console")
+		if err != nil {
+			b.cleanup()
+			return nil, err
+		}
+		b.files = append(b.files, b.ConsoleFile)
+		b.Console = log.New(b.ConsoleFile, "", log.Lshortfile|log.LstdFlags)
 	}
-	b.Console = log.New(b.ConsoleFile, "", log.Lshortfile|log.LstdFlags)
 
-	b.Port = port
+	path := opts.Path
+	if path == "" {
+		if path, err = FindBrowser(); err != nil {
+			b.cleanup()
+			return nil, err
+		}
+	}
 
-	// Add required values
-	required := []string{"--no-first-run", "--no-default-browser-check"}
-	for _, req := range required {
-		sort.Strings(args)
-		at := sort.SearchStrings(args, req)
-		if at == len(args) || args[at] != req {
-			args = append(args, req)
+	// A port or profile given as a raw flag is used in place of the field.
+	b.Port = opts.Port
+	if value, ok := flagValue(opts.Flags, "--remote-debugging-port"); ok {
+		if b.Port, err = strconv.Atoi(value); err != nil {
+			b.cleanup()
+			return nil, fmt.Errorf("invalid --remote-debugging-port: %s", err)
 		}
 	}
+	if value, ok := flagValue(opts.Flags, "--user-data-dir"); ok {
+		opts.UserDataDir = value
+	}
+	for _, flag := range opts.Flags {
+		if flag == "--remote-debugging-pipe" {
+			opts.Pipe = true
+		}
+	}
+	args := opts.args()
 
-	// Temp directory
-	dir, err := ioutil.TempDir("", "cdp-")
-	if err != nil {
-		panic(err)
+	// User data directory
+	if opts.UserDataDir != "" {
+		b.TempDir = opts.UserDataDir
+		b.keepDir = true
+		if err := os.MkdirAll(b.TempDir, 0700); err != nil {
+			b.cleanup()
+			return nil, err
+		}
+		// A file left behind by an earlier run must not be mistaken for the new port.
+		if err := os.Remove(filepath.Join(b.TempDir, "DevToolsActivePort")); err != nil && !os.IsNotExist(err) {
+			b.cleanup()
+			return nil, err
+		}
+	} else {
+		dir, err := ioutil.TempDir("", "cdp-")
+		if err != nil {
+			b.cleanup()
+			return nil, err
+		}
+		b.TempDir = dir
 	}
-	b.TempDir = dir
-	args = append(args, fmt.Sprintf("--user-data-dir=%s", b.TempDir))
+	args = mergeFlags(args, []string{fmt.Sprintf("--user-data-dir=%s", b.TempDir)})
 
-	// Debugging port of the browser
-	debuggingPort := fmt.Sprintf("--remote-debugging-port=%d", b.Port)
-	args = append(args, debuggingPort)
-	log.Printf("Args %+v", args)
+	// Debugging port or pipe of the browser
+	if opts.Pipe {
+		args = mergeFlags(args, []string{"--remote-debugging-pipe"})
+	} else {
+		args = mergeFlags(args, []string{fmt.Sprintf("--remote-debugging-port=%d", b.Port)})
+	}
+	b.logger().Log(LogBasic, "launching the browser", Field{FieldMessage, strings.Join(append([]string{path}, args...), " ")})
 
 	cmd := exec.Command(path, args...)
+	cmd.Env = opts.environ()
 
-	// Prepare to send output to the log file
-	stdout, err := cmd.StdoutPipe()
+	// The browser gets its own process group so that Stop also reaches the renderer and helper processes.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	// Prepare to send output to the log file.
+	// The pipes are created here rather than with cmd.StdoutPipe so that waiting on the browser does not also wait on children that inherited them.
+	stdout, stdoutW, err := os.Pipe()
 	if err != nil {
-		panic(err)
+		b.cleanup()
+		return nil, err
 	}
-	stderr, err := cmd.StderrPipe()
+	stderr, stderrW, err := os.Pipe()
 	if err != nil {
-		panic(err)
+		stdout.Close()
+		stdoutW.Close()
+		b.cleanup()
+		return nil, err
+	}
+	cmd.Stdout = stdoutW
+	cmd.Stderr = stderrW
+
+	// In pipe mode the browser reads commands from its file descriptor 3 and writes to 4.
+	var pipeFiles []*os.File
+	if opts.Pipe {
+		commands, commandsW, err := os.Pipe()
+		if err == nil {
+			var repliesR, replies *os.File
+			if repliesR, replies, err = os.Pipe(); err != nil {
+				commands.Close()
+				commandsW.Close()
+			} else {
+				pipeFiles = []*os.File{commands, replies}
+				b.pipe = NewPipeTransport(repliesR, commandsW)
+			}
+		}
+		if err != nil {
+			for _, f := range []*os.File{stdout, stdoutW, stderr, stderrW} {
+				f.Close()
+			}
+			b.cleanup()
+			return nil, err
+		}
+		cmd.ExtraFiles = pipeFiles
 	}
 
 	// Start the browser
-	if err := cmd.Start(); err != nil {
-		panic(err)
+	err = cmd.Start()
+	stdoutW.Close()
+	stderrW.Close()
+	for _, f := range pipeFiles {
+		f.Close()
+	}
+	if err != nil {
+		stdout.Close()
+		stderr.Close()
+		b.cleanup()
+		return nil, err
 	}
 	b.PID = cmd.Process.Pid
 
-	// The browser does need a moment to start up.  This will probably differ on different systems.
-	time.Sleep(time.Second * 1)
-
-	// Feed output to the log
+	// Feed output to the log while watching for the browser to announce its websocket url.
+	listening := make(chan string, 1)
 	go func() {
+		defer stdout.Close()
 		sout := bufio.NewScanner(stdout)
 		for sout.Scan() {
-			log.Print(sout.Text())
+			b.logger().Log(LogAll, "browser output", Field{FieldMessage, sout.Text()})
 		}
 		if err := sout.Err(); err != nil {
-			log.Printf("error: %s", err)
+			b.logger().Log(LogError, err.Error())
 		}
 	}()
 	go func() {
+		defer stderr.Close()
 		serr := bufio.NewScanner(stderr)
 		for serr.Scan() {
-			log.Print(serr.Text())
+			line := serr.Text()
+			b.logger().Log(LogAll, "browser output", Field{FieldMessage, line})
+			if strings.HasPrefix(line, devToolsListening) {
+				select {
+				case listening <- strings.TrimSpace(strings.TrimPrefix(line, devToolsListening)):
+				default:
+				}
+			}
 		}
 		if err := serr.Err(); err != nil {
-			log.Printf("error: %s", err)
+			b.logger().Log(LogError, err.Error())
 		}
 	}()
-	return b
+
+	// Reap the process as soon as it exits so that crashes are noticed and no zombie is left behind.
+	b.exited = make(chan struct{})
+	go func() {
+		b.exitErr = cmd.Wait()
+		if b.exitErr != nil {
+			b.logger().Log(LogError, "browser exited", Field{FieldError, b.exitErr})
+		}
+		close(b.exited)
+	}()
+
+	if b.pipe != nil {
+		// Commands written to the pipe wait until the browser reads them, so there is nothing to wait on.
+		return b, nil
+	}
+	if err := b.waitReady(listening); err != nil {
+		b.logger().Log(LogError, err.Error())
+		if e := b.Stop(); e != nil {
+			b.logger().Log(LogError, e.Error())
+		}
+		return nil, err
+	}
+	return b, nil
 }
 
-// Stop kills the running browser process.
-func (b *Browser) Stop() {
-	log.Print("stopping the browser")
-	if b.PID == 0 {
-		log.Print("no process id for the browser")
-		return
+// devToolsListening prefixes the line that the browser writes to stderr once it accepts devtools connections.
+const devToolsListening = "DevTools listening on "
+
+// waitReady blocks until the browser announces its websocket url on stderr or answers on its /json/version endpoint.
+func (b *Browser) waitReady(listening <-chan string) error {
+	deadline := time.After(StartupTimeout)
+	poll := time.NewTicker(time.Millisecond * 100)
+	defer poll.Stop()
+
+	for {
+		select {
+		case ws := <-listening:
+			if b.Port == 0 {
+				port, err := urlPort(ws)
+				if err != nil {
+					if port, err = b.activePort(); err != nil {
+						return err
+					}
+				}
+				b.Port = port
+			}
+			b.WebSocketURL = ws
+			return nil
+		case <-poll.C:
+			if b.Port == 0 {
+				port, err := b.activePort()
+				if err != nil {
+					continue
+				}
+				b.Port = port
+			}
+			version := map[string]interface{}{}
+			if err := getJSON(DiscardLogger, fmt.Sprintf("http://localhost:%d/json/version", b.Port), &version); err == nil {
+				if ws, ok := version["webSocketDebuggerUrl"].(string); ok {
+					b.WebSocketURL = ws
+					return nil
+				}
+			}
+		case <-b.exited:
+			return fmt.Errorf("browser exited before listening for devtools connections: %v", b.exitErr)
+		case <-deadline:
+			return fmt.Errorf("browser startup %w after %s", ErrTimeout, StartupTimeout)
+		}
 	}
-	err := syscall.Kill(b.PID, syscall.SIGKILL)
+}
+
+// activePort reads the port that the browser is listening on from the DevToolsActivePort file.
+// The browser writes this file to its user data directory and the port is on the first line.
+func (b *Browser) activePort() (int, error) {
+	data, err := ioutil.ReadFile(filepath.Join(b.TempDir, "DevToolsActivePort"))
 	if err != nil {
-		panic(err)
+		return 0, err
 	}
-	if b.TempDir != "" {
-		err := os.RemoveAll(b.TempDir)
-		if err != nil {
-			log.Printf("error: %s", err)
-		}
+	lines := strings.SplitN(string(data), "\n", 2)
+	port, err := strconv.Atoi(strings.TrimSpace(lines[0]))
+	if err != nil {
+		return 0, fmt.Errorf("invalid DevToolsActivePort file: %s", err)
+	}
+	if port <= 0 {
+		return 0, fmt.Errorf("invalid DevToolsActivePort port %d", port)
 	}
-	err = b.LogFile.Close()
+	return port, nil
+}
+
+// urlPort returns the port of the websocket url.
+func urlPort(ws string) (int, error) {
+	u, err := url.Parse(ws)
 	if err != nil {
-		log.Printf("error: %s", err)
+		return 0, err
+	}
+	return strconv.Atoi(u.Port())
+}
+
+// StopTimeout is how long Stop waits for the browser to exit after each attempt to end it before making a more forceful one.
+var StopTimeout = time.Second * 5
+
+// Done returns a channel that is closed once the browser process has exited.
+// The channel is nil, and so never closes, for a Browser that was not started with NewBrowser.
+func (b *Browser) Done() <-chan struct{} {
+	return b.exited
+}
+
+// Err returns the reason that the browser process exited or nil while it is still running or if it exited successfully.
+func (b *Browser) Err() error {
+	select {
+	case <-b.exited:
+		return b.exitErr
+	default:
+		return nil
+	}
+}
+
+// logger returns the browser's logger.  It is safe to call on a nil browser.
+func (b *Browser) logger() Logger {
+	if b == nil {
+		return DiscardLogger
+	}
+	if b.Logger != nil {
+		return b.Logger
+	}
+	if b.Log != nil {
+		return NewStdLogger(b.Log)
+	}
+	return DiscardLogger
+}
+
+// Stop shuts the browser down and removes its temp directory.
+// The browser is first asked to close over the devtools protocol, then the process group is sent SIGTERM and finally SIGKILL,
+// waiting StopTimeout after each step.  Stop returns once the process has exited.
+// If the browser had already exited unexpectedly, or exits with a failure status, the error wraps ErrBrowserExited.
+// Later calls return the result of the first one.
+func (b *Browser) Stop() error {
+	b.stopOnce.Do(func() {
+		b.stopErr = b.stop()
+	})
+	return b.stopErr
+}
+
+func (b *Browser) stop() error {
+	b.logger().Log(LogBasic, "stopping the browser")
+	if b.PID == 0 {
+		b.logger().Log(LogBasic, "no process id for the browser")
+		return nil
+	}
+	if b.exited == nil {
+		err := syscall.Kill(b.PID, syscall.SIGKILL)
+		if e := b.cleanup(); err == nil {
+			err = e
+		}
+		return err
+	}
+
+	var err error
+	select {
+	case <-b.exited:
+		if b.exitErr != nil {
+			err = fmt.Errorf("%w before stopping: %v", ErrBrowserExited, b.exitErr)
+		}
+	default:
+		var sent syscall.Signal
+		closed := b.closeBrowser()
+		if closed != nil {
+			b.logger().Log(LogError, "close the browser: "+closed.Error())
+		}
+		if closed != nil || !b.waitExit(StopTimeout) {
+			b.logger().Log(LogBasic, "terminating the browser")
+			sent = syscall.SIGTERM
+			if e := syscall.Kill(-b.PID, sent); e != nil {
+				b.logger().Log(LogError, e.Error())
+			}
+			if !b.waitExit(StopTimeout) {
+				b.logger().Log(LogBasic, "killing the browser")
+				sent = syscall.SIGKILL
+				if e := syscall.Kill(-b.PID, sent); e != nil {
+					b.logger().Log(LogError, e.Error())
+				}
+				b.waitExit(StopTimeout)
+			}
+		}
+		err = b.exitStatus(sent)
+	}
+
+	// Children of the browser can outlive it.
+	if e := syscall.Kill(-b.PID, syscall.SIGKILL); e != nil && e != syscall.ESRCH {
+		b.logger().Log(LogError, e.Error())
+	}
+	if e := b.cleanup(); err == nil {
+		err = e
+	}
+	return err
+}
+
+// closeBrowser sends Browser.close to the browser target, which shuts the browser down cleanly.
+// A browser driven over a pipe is shut down by closing the pipe instead.
+func (b *Browser) closeBrowser() error {
+	if b.pipe != nil {
+		return b.pipe.Close()
+	}
+	if b.WebSocketURL == "" {
+		return fmt.Errorf("no websocket url for the browser")
 	}
-	err = b.ConsoleFile.Close()
+	dialer := websocket.Dialer{HandshakeTimeout: StopTimeout}
+	c, _, err := dialer.Dial(b.WebSocketURL, nil)
 	if err != nil {
-		log.Printf("error: %s", err)
+		return err
+	}
+	defer c.Close()
+
+	return c.WriteJSON(map[string]interface{}{"id": 1, "method": browser.CommandBrowserClose})
+}
+
+// waitExit waits at most the timeout for the browser process to exit and indicates whether it did.
+func (b *Browser) waitExit(timeout time.Duration) bool {
+	select {
+	case <-b.exited:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// exitStatus returns an error if the browser has not exited or exited unsuccessfully for a reason other than the signal that Stop sent.
+func (b *Browser) exitStatus(sent syscall.Signal) error {
+	select {
+	case <-b.exited:
+	default:
+		return fmt.Errorf("browser process %d did not exit", b.PID)
+	}
+	if b.exitErr == nil {
+		return nil
+	}
+	if exit, ok := b.exitErr.(*exec.ExitError); ok {
+		if status, ok := exit.Sys().(syscall.WaitStatus); ok && status.Signaled() && status.Signal() == sent {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %v", ErrBrowserExited, b.exitErr)
+}
+
+// cleanup removes the temp directory and closes the log files.  The first error encountered is returned.
+func (b *Browser) cleanup() error {
+	var err error
+	if b.pipe != nil {
+		b.pipe.Close()
+	}
+	if b.TempDir != "" && !b.keepDir {
+		if e := os.RemoveAll(b.TempDir); e != nil {
+			b.logger().Log(LogError, e.Error())
+			err = e
+		}
+	}
+	// The log files are closed last since the records above may be written to them.
+	for _, f := range b.files {
+		if e := f.Close(); e != nil && err == nil {
+			err = e
+		}
 	}
+	b.files = nil
+	return err
 }
@@ -0,0 +1,242 @@
+package cdp
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/4ydx/cdp/protocol/page"
+	"github.com/gorilla/websocket"
+)
+
+// FakeBrowser writes a shell script that stands in for the browser binary.
+func FakeBrowser(t *testing.T, script string) string {
+	dir, err := ioutil.TempDir("", "cdp-fake-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "browser")
+	if err := ioutil.WriteFile(path, []byte("#!/bin/sh\n"+script), 0700); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestNewBrowserListening(t *testing.T) {
+	path := FakeBrowser(t, "echo 'DevTools listening on ws://127.0.0.1:9/devtools/browser/abc' >&2\nexec sleep 10\n")
+	defer os.RemoveAll(filepath.Dir(path))
+
+	logfile := filepath.Join(filepath.Dir(path), "browser.log")
+	start := time.Now()
+	browser, err := NewBrowser(path, 9, logfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer browser.Stop()
+
+	if browser.WebSocketURL != "ws://127.0.0.1:9/devtools/browser/abc" {
+		t.Fatalf("Unexpected websocket url %q", browser.WebSocketURL)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("Expecting the browser to be ready as soon as it announced its websocket url.")
+	}
+}
+
+func TestNewBrowserExited(t *testing.T) {
+	path := FakeBrowser(t, "echo 'missing display' >&2\nexit 1\n")
+	defer os.RemoveAll(filepath.Dir(path))
+
+	logfile := filepath.Join(filepath.Dir(path), "browser.log")
+	if _, err := NewBrowser(path, 9, logfile); err == nil {
+		t.Fatal("Expecting an error when the browser exits during startup.")
+	}
+}
+
+func TestNewBrowserMissing(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cdp-fake-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if _, err := NewBrowser(filepath.Join(dir, "missing"), 9, filepath.Join(dir, "browser.log")); err == nil {
+		t.Fatal("Expecting an error when the browser binary does not exist.")
+	}
+}
+
+func TestNewBrowserFreePort(t *testing.T) {
+	timeout := StopTimeout
+	StopTimeout = time.Millisecond * 200
+	defer func() {
+		StopTimeout = timeout
+	}()
+
+	srv, port := ServeCommands(t, func(c *websocket.Conn, m Message) {})
+	defer srv.Close()
+
+	// The fake browser only announces its port through the DevToolsActivePort file in its user data directory.
+	path := FakeBrowser(t, fmt.Sprintf(`for arg in "$@"; do
+	case "$arg" in
+	--user-data-dir=*) dir="${arg#--user-data-dir=}" ;;
+	--remote-debugging-port=0) free=1 ;;
+	esac
+done
+[ -n "$free" ] || exit 1
+printf '%d\n/devtools/browser/abc\n' > "$dir/DevToolsActivePort"
+exec sleep 10
+`, port))
+	defer os.RemoveAll(filepath.Dir(path))
+
+	browser, err := NewBrowser(path, 0, filepath.Join(filepath.Dir(path), "browser.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer browser.Stop()
+
+	if browser.Port != port {
+		t.Fatalf("Expecting port %d but got %d", port, browser.Port)
+	}
+	if browser.WebSocketURL == "" {
+		t.Fatal("Expecting the websocket url from /json/version.")
+	}
+}
+
+func TestNewBrowserListeningFreePort(t *testing.T) {
+	path := FakeBrowser(t, "echo 'DevTools listening on ws://127.0.0.1:41234/devtools/browser/abc' >&2\nexec sleep 10\n")
+	defer os.RemoveAll(filepath.Dir(path))
+
+	browser, err := NewBrowser(path, 0, filepath.Join(filepath.Dir(path), "browser.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer browser.Stop()
+
+	if browser.Port != 41234 {
+		t.Fatalf("Expecting the announced port but got %d", browser.Port)
+	}
+}
+
+func TestBrowserStopClose(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cdp-fake-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	closed := filepath.Join(dir, "closed")
+	srv, port := ServeCommands(t, func(c *websocket.Conn, m Message) {
+		if m.Method == "Browser.close" {
+			if err := ioutil.WriteFile(closed, nil, 0600); err != nil {
+				t.Error(err)
+			}
+		}
+	})
+	defer srv.Close()
+
+	// The fake browser exits once it has been sent Browser.close.
+	path := FakeBrowser(t, fmt.Sprintf(`echo 'DevTools listening on ws://127.0.0.1:%d/ws' >&2
+while [ ! -f %s ]; do sleep 0.01; done
+exit 0
+`, port, closed))
+	defer os.RemoveAll(filepath.Dir(path))
+
+	browser, err := NewBrowser(path, port, filepath.Join(dir, "browser.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if err := browser.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) > StopTimeout {
+		t.Fatal("Expecting the browser to exit after Browser.close without being signalled.")
+	}
+	select {
+	case <-browser.Done():
+	default:
+		t.Fatal("Expecting the browser process to be reaped.")
+	}
+	if browser.Err() != nil {
+		t.Fatalf("Expecting a successful exit but got %s", browser.Err())
+	}
+}
+
+func TestBrowserStopSignals(t *testing.T) {
+	timeout := StopTimeout
+	StopTimeout = time.Millisecond * 200
+	defer func() {
+		StopTimeout = timeout
+	}()
+
+	tests := []struct {
+		name   string
+		trap   string
+		exited bool
+	}{
+		{name: "terminate", trap: "trap 'exit 0' TERM", exited: true},
+		{name: "kill", trap: "trap '' TERM", exited: false},
+	}
+	for _, test := range tests {
+		path := FakeBrowser(t, test.trap+"\necho 'DevTools listening on ws://127.0.0.1:9/devtools/browser/abc' >&2\nwhile :; do sleep 0.01; done\n")
+		defer os.RemoveAll(filepath.Dir(path))
+
+		browser, err := NewBrowser(path, 9, filepath.Join(filepath.Dir(path), "browser.log"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := browser.Stop(); err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		if err := browser.Stop(); err != nil {
+			t.Fatalf("%s: expecting a second stop to succeed but got %s", test.name, err)
+		}
+		if (browser.Err() == nil) != test.exited {
+			t.Fatalf("%s: unexpected exit status %v", test.name, browser.Err())
+		}
+		if _, err := os.Stat(browser.TempDir); !os.IsNotExist(err) {
+			t.Fatalf("%s: expecting the temp dir to be removed", test.name)
+		}
+	}
+}
+
+func TestBrowserExited(t *testing.T) {
+	srv, port := ServeCommands(t, func(c *websocket.Conn, m Message) {})
+	defer srv.Close()
+
+	// The fake browser crashes while a command is waiting on a reply.
+	path := FakeBrowser(t, fmt.Sprintf("echo 'DevTools listening on ws://127.0.0.1:%d/ws' >&2\nsleep 0.3\nexit 3\n", port))
+	defer os.RemoveAll(filepath.Dir(path))
+
+	browser, err := NewBrowser(path, port, filepath.Join(filepath.Dir(path), "browser.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame, err := StartBrowser(browser, LogBasic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer frame.Stop(false)
+
+	start := time.Now()
+	err = NewAction(
+		[]Event{},
+		[]Command{
+			Command{ID: frame.RequestID.GetNext(), Method: page.CommandPageBringToFront, Params: &page.BringToFrontArgs{}, Reply: &page.BringToFrontReply{}, Timeout: time.Second * 10},
+		}).Run(frame)
+	if !errors.Is(err, ErrBrowserExited) {
+		t.Fatalf("Expecting a browser exited error but got %v", err)
+	}
+	if time.Since(start) > time.Second*5 {
+		t.Fatal("Expecting the action to fail as soon as the browser exited.")
+	}
+	if err := browser.Stop(); !errors.Is(err, ErrBrowserExited) {
+		t.Fatalf("Expecting the crash to be reported when stopping but got %v", err)
+	}
+	if err := browser.Stop(); !errors.Is(err, ErrBrowserExited) {
+		t.Fatalf("Expecting a second stop to report the crash again but got %v", err)
+	}
+}
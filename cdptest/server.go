@@ -0,0 +1,292 @@
+// Package cdptest provides a scriptable devtools endpoint for testing code that uses chrome-protocol without a browser.
+package cdptest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/4ydx/chrome-protocol"
+	"github.com/gorilla/websocket"
+)
+
+// Event is a message that the server sends without it being a reply to a command.
+// An empty SessionID sends the event for the session of the command that triggered it.
+type Event struct {
+	Method    string
+	Params    interface{}
+	SessionID string
+}
+
+// Response describes how the server answers a command.
+type Response struct {
+	Result     interface{}   // Encoded as the reply's result.  A nil result is sent as an empty object.
+	Error      *cdp.Error    // Sent in place of the result when set.
+	Delay      time.Duration // Time to wait before replying.
+	Events     []Event       // Sent after the reply.
+	NoReply    bool          // The command is never answered, although Events are still sent.
+	Disconnect bool          // The connection is closed instead of replying.
+}
+
+// Handler returns the response to a command.
+type Handler func(m cdp.Message) Response
+
+// Server is an in-process devtools endpoint that serves /json, /json/version, and a websocket.
+// Commands without a registered handler are answered with an empty result.
+type Server struct {
+	*httptest.Server
+	Port         int
+	WebSocketURL string
+
+	mu       sync.Mutex
+	handlers map[string]Handler
+	received []cdp.Message
+	conns    map[*websocket.Conn]*sync.Mutex
+	notify   chan struct{}
+}
+
+var upgrader = websocket.Upgrader{}
+
+// NewServer starts a server.  It should be closed with Close.
+func NewServer() *Server {
+	s := &Server{
+		handlers: map[string]Handler{},
+		conns:    map[*websocket.Conn]*sync.Mutex{},
+		notify:   make(chan struct{}),
+	}
+	mux := http.NewServeMux()
+	s.Server = httptest.NewServer(mux)
+	s.WebSocketURL = "ws://" + s.Listener.Addr().String() + "/devtools/browser/cdptest"
+	_, port, _ := net.SplitHostPort(s.Listener.Addr().String())
+	s.Port, _ = strconv.Atoi(port)
+
+	mux.HandleFunc("/json", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, []map[string]string{{"type": "page", "webSocketDebuggerUrl": s.WebSocketURL}})
+	})
+	mux.HandleFunc("/json/version", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]string{"Browser": "cdptest", "webSocketDebuggerUrl": s.WebSocketURL})
+	})
+	mux.HandleFunc("/devtools/browser/cdptest", s.serveWebsocket)
+	return s
+}
+
+// Browser returns a browser value for connecting to the server with cdp.Start or cdp.StartBrowser.
+// Nothing is logged.
+func (s *Server) Browser() *cdp.Browser {
+	return &cdp.Browser{
+		Port:         s.Port,
+		WebSocketURL: s.WebSocketURL,
+		Log:          log.New(ioutil.Discard, "", 0),
+		Console:      log.New(ioutil.Discard, "", 0),
+	}
+}
+
+// Handle registers the handler for commands with the given method, replacing any earlier handler.
+func (s *Server) Handle(method string, handler Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.handlers[method] = handler
+}
+
+// Reply answers commands with the given method with the result followed by the events.
+func (s *Server) Reply(method string, result interface{}, events ...Event) {
+	s.Handle(method, func(m cdp.Message) Response {
+		return Response{Result: result, Events: events}
+	})
+}
+
+// Fail answers commands with the given method with a protocol error.
+func (s *Server) Fail(method string, code int64, message string) {
+	s.Handle(method, func(m cdp.Message) Response {
+		return Response{Error: &cdp.Error{Code: code, Message: message}}
+	})
+}
+
+// Emit sends the event on every open connection.
+func (s *Server) Emit(event Event) error {
+	s.mu.Lock()
+	conns := s.connections()
+	s.mu.Unlock()
+
+	for c, mu := range conns {
+		if err := send(c, mu, eventMessage(event, "")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Disconnect closes every open connection, as if the browser went away.
+func (s *Server) Disconnect() {
+	s.mu.Lock()
+	conns := s.connections()
+	s.mu.Unlock()
+
+	for c := range conns {
+		c.Close()
+	}
+}
+
+// Received returns the commands that the server has received in order.
+func (s *Server) Received() []cdp.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]cdp.Message{}, s.received...)
+}
+
+// ReceivedMethods returns the methods of the commands that the server has received in order.
+func (s *Server) ReceivedMethods() []string {
+	methods := []string{}
+	for _, m := range s.Received() {
+		methods = append(methods, m.Method)
+	}
+	return methods
+}
+
+// WaitFor waits until a command with the given method has been received and returns the first such command.
+func (s *Server) WaitFor(method string, timeout time.Duration) (cdp.Message, error) {
+	deadline := time.After(timeout)
+	for {
+		s.mu.Lock()
+		notify := s.notify
+		for _, m := range s.received {
+			if m.Method == method {
+				s.mu.Unlock()
+				return m, nil
+			}
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-notify:
+		case <-deadline:
+			return cdp.Message{}, fmt.Errorf("%s was not received within %s", method, timeout)
+		}
+	}
+}
+
+// Close disconnects every connection and shuts the server down.
+func (s *Server) Close() {
+	s.Disconnect()
+	s.Server.Close()
+}
+
+func (s *Server) serveWebsocket(w http.ResponseWriter, r *http.Request) {
+	c, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	mu := &sync.Mutex{}
+	s.mu.Lock()
+	s.conns[c] = mu
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+		c.Close()
+	}()
+	for {
+		_, message, err := c.ReadMessage()
+		if err != nil {
+			return
+		}
+		m := cdp.Message{}
+		if err := json.Unmarshal(message, &m); err != nil {
+			continue
+		}
+
+		s.mu.Lock()
+		s.received = append(s.received, m)
+		close(s.notify)
+		s.notify = make(chan struct{})
+		handler, ok := s.handlers[m.Method]
+		s.mu.Unlock()
+
+		response := Response{}
+		if ok {
+			response = handler(m)
+		}
+		// Replies are sent in their own goroutine so that a delayed reply does not hold up other commands.
+		go s.respond(c, mu, m, response)
+	}
+}
+
+func (s *Server) respond(c *websocket.Conn, mu *sync.Mutex, m cdp.Message, response Response) {
+	if response.Delay > 0 {
+		time.Sleep(response.Delay)
+	}
+	if response.Disconnect {
+		c.Close()
+		return
+	}
+	if !response.NoReply {
+		reply := map[string]interface{}{"id": m.ID}
+		if m.SessionID != "" {
+			reply["sessionId"] = m.SessionID
+		}
+		if response.Error != nil {
+			reply["error"] = response.Error
+		} else if response.Result != nil {
+			reply["result"] = response.Result
+		} else {
+			reply["result"] = map[string]interface{}{}
+		}
+		if err := send(c, mu, reply); err != nil {
+			return
+		}
+	}
+	for _, event := range response.Events {
+		if err := send(c, mu, eventMessage(event, m.SessionID)); err != nil {
+			return
+		}
+	}
+}
+
+// connections returns a copy of the open connections.  The server's lock must be held.
+func (s *Server) connections() map[*websocket.Conn]*sync.Mutex {
+	conns := map[*websocket.Conn]*sync.Mutex{}
+	for c, mu := range s.conns {
+		conns[c] = mu
+	}
+	return conns
+}
+
+func eventMessage(event Event, sessionID string) map[string]interface{} {
+	m := map[string]interface{}{"method": event.Method}
+	if event.Params != nil {
+		m["params"] = event.Params
+	} else {
+		m["params"] = map[string]interface{}{}
+	}
+	if event.SessionID != "" {
+		sessionID = event.SessionID
+	}
+	if sessionID != "" {
+		m["sessionId"] = sessionID
+	}
+	return m
+}
+
+// send writes the value to the connection.  Writes to a connection must not happen concurrently.
+func send(c *websocket.Conn, mu *sync.Mutex, value interface{}) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	return c.WriteJSON(value)
+}
+
+func writeJSON(w http.ResponseWriter, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(value)
+}
@@ -0,0 +1,67 @@
+package cdptest
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/4ydx/cdp/protocol/page"
+	"github.com/4ydx/chrome-protocol"
+)
+
+func TestServer(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+
+	frame, err := cdp.Start(server.Browser(), cdp.LogBasic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer frame.Stop(false)
+
+	// A delayed reply times out the command.
+	server.Handle(page.CommandPageBringToFront, func(m cdp.Message) Response {
+		return Response{Delay: time.Millisecond * 200}
+	})
+	err = cdp.NewAction(
+		[]cdp.Event{},
+		[]cdp.Command{
+			cdp.Command{ID: frame.RequestID.GetNext(), Method: page.CommandPageBringToFront, Params: &page.BringToFrontArgs{}, Reply: &page.BringToFrontReply{}, Timeout: time.Millisecond * 50},
+		}).Run(frame)
+	if !errors.Is(err, cdp.ErrTimeout) {
+		t.Fatalf("Expecting a timeout but got %v", err)
+	}
+
+	// Events can be sent at any time.
+	value := make(chan json.Unmarshaler)
+	go func() {
+		v, err := frame.WaitForEvent(page.EventPageLoadEventFired, nil, time.Second*2)
+		if err != nil {
+			t.Error(err)
+		}
+		value <- v
+	}()
+	if _, err := server.WaitFor(page.CommandPageBringToFront, time.Second); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		frame.RLock()
+		count := len(frame.Subscriptions)
+		frame.RUnlock()
+		if count == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := server.Emit(Event{Method: page.EventPageLoadEventFired, Params: map[string]float64{"timestamp": 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if v := <-value; v.(*page.LoadEventFiredReply).Timestamp != 1 {
+		t.Fatalf("Unexpected event %+v", v)
+	}
+
+	if _, err := server.WaitFor(page.CommandPageNavigate, time.Millisecond*10); err == nil {
+		t.Fatal("Expecting an error for a command that was never sent.")
+	}
+}
@@ -0,0 +1,154 @@
+package cdp
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// ConnectOptions specifies how Connect reaches a devtools endpoint and which of its targets it drives.
+type ConnectOptions struct {
+	Header    http.Header // Sent with the discovery requests and the websocket handshake, for instance to authenticate with a proxy.
+	TLSConfig *tls.Config // Used for https and wss endpoints.
+
+	// Browser connects to the browser target rather than a page target.  Pages are then reached through sessions as with StartBrowser.
+	Browser bool
+
+	// TargetURL and TargetTitle pick the first page whose url or title contains the value.  Both must match when both are set.
+	TargetURL   string
+	TargetTitle string
+
+	// Match picks the first target that it returns true for.  It is used instead of TargetURL and TargetTitle when set.
+	Match func(t DiscoveredTarget) bool
+
+	LogLevel LogLevelValue
+	Logger   Logger // Receives the frame's records up to LogLevel and the errors of the discovery.  When nil the records are dropped.
+
+	// Reconnect and OnState are set on the frame before its loops start.  See Frame.Reconnect and Frame.OnState.
+	Reconnect *ReconnectPolicy
+	OnState   func(state ConnState, err error)
+}
+
+// DiscoveredTarget is an entry of the target list of a devtools endpoint.
+type DiscoveredTarget struct {
+	ID                   string `json:"id"`
+	Type                 string `json:"type"`
+	Title                string `json:"title"`
+	URL                  string `json:"url"`
+	WebSocketDebuggerURL string `json:"webSocketDebuggerUrl"`
+}
+
+// matches indicates that the target is the one that the options ask for.  Without any criteria the first page matches.
+func (o ConnectOptions) matches(t DiscoveredTarget) bool {
+	if o.Match != nil {
+		return o.Match(t)
+	}
+	return t.Type == "page" && strings.Contains(t.URL, o.TargetURL) && strings.Contains(t.Title, o.TargetTitle)
+}
+
+func (o ConnectOptions) logger() Logger {
+	if o.Logger != nil {
+		return o.Logger
+	}
+	return DiscardLogger
+}
+
+// dial connects to the websocket url with the options' header and TLS configuration.
+func (o ConnectOptions) dial(ctx context.Context, ws string) (Transport, error) {
+	d := *websocket.DefaultDialer
+	d.TLSClientConfig = o.TLSConfig
+	conn, err := dialContext(ctx, o.logger(), &d, ws, o.Header)
+	if err != nil {
+		return nil, err
+	}
+	return NewWebsocketTransport(conn), nil
+}
+
+func (o ConnectOptions) client() *http.Client {
+	if o.TLSConfig == nil {
+		return http.DefaultClient
+	}
+	return &http.Client{Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: o.TLSConfig}}
+}
+
+// StartWithURL connects to the devtools endpoint at the given url.  It is Connect without a deadline or any other options, and its records go to standard error.
+func StartWithURL(endpoint string, logLevel LogLevelValue) (*Frame, error) {
+	return Connect(context.Background(), endpoint, ConnectOptions{LogLevel: logLevel, Logger: NewStdLogger(log.New(os.Stderr, "", log.LstdFlags))})
+}
+
+// Connect begins automation of a browser that is reachable at the endpoint, which may run in another container or behind a tunnel.
+// A ws:// or wss:// endpoint is dialed as it is.  An http:// or https:// endpoint is the browser's devtools address, such as http://host:9222,
+// whose target list is used to find the websocket of the target that the options pick.  The host of the found websocket is replaced by the endpoint's
+// host since the browser reports the address that it listens on, which is often not reachable from outside.
+// The context limits the discovery and the handshake.  On reconnect the websocket that was found is dialed again, so the frame stays on its target after the page navigates.
+func Connect(ctx context.Context, endpoint string, opts ConnectOptions) (*Frame, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	ws := endpoint
+	switch u.Scheme {
+	case "ws", "wss":
+	case "http", "https":
+		if ws, err = discover(ctx, u, opts); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported devtools endpoint %q", endpoint)
+	}
+	t, err := opts.dial(ctx, ws)
+	if err != nil {
+		return nil, err
+	}
+	redial := func() (Transport, error) {
+		return opts.dial(context.Background(), ws)
+	}
+	return start(nil, t, redial, StartOptions{LogLevel: opts.LogLevel, Logger: opts.Logger, Reconnect: opts.Reconnect, OnState: opts.OnState}), nil
+}
+
+// discover returns the websocket url of the target that the options pick from the endpoint's target list.
+func discover(ctx context.Context, endpoint *url.URL, opts ConnectOptions) (string, error) {
+	list := *endpoint
+	list.Path = strings.TrimSuffix(list.Path, "/") + "/json"
+	ws := ""
+	if opts.Browser {
+		list.Path += "/version"
+		version := DiscoveredTarget{}
+		if err := fetchJSON(ctx, opts.logger(), opts.client(), list.String(), opts.Header, &version); err != nil {
+			return "", err
+		}
+		ws = version.WebSocketDebuggerURL
+	} else {
+		targets := []DiscoveredTarget{}
+		if err := fetchJSON(ctx, opts.logger(), opts.client(), list.String(), opts.Header, &targets); err != nil {
+			return "", err
+		}
+		for _, t := range targets {
+			if t.WebSocketDebuggerURL != "" && opts.matches(t) {
+				ws = t.WebSocketDebuggerURL
+				break
+			}
+		}
+	}
+	if ws == "" {
+		return "", fmt.Errorf("%w at %s", ErrTargetNotFound, list.String())
+	}
+
+	u, err := url.Parse(ws)
+	if err != nil {
+		return "", err
+	}
+	u.Host = endpoint.Host
+	u.Path = strings.TrimSuffix(endpoint.Path, "/") + u.Path
+	if endpoint.Scheme == "https" {
+		u.Scheme = "wss"
+	}
+	return u.String(), nil
+}
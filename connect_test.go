@@ -0,0 +1,183 @@
+package cdp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/4ydx/cdp/protocol/page"
+	"github.com/gorilla/websocket"
+)
+
+// ServeEndpoint starts a devtools endpoint that lists a worker and two pages, requires an Authorization header, and answers every command.
+// The listed websocket urls use a host that cannot be reached.  The returned function reports the path of the last websocket connection.
+// Page.stopLoading drops the connection and navigates page B to another url and title.
+func ServeEndpoint(t *testing.T, tls bool) (*httptest.Server, func() string) {
+	var mu sync.Mutex
+	last := ""
+	navigated := false
+	srv, _ := ServeDevtools(t, TestEndpoint{
+		TLS: tls,
+		Targets: func(host string) []DiscoveredTarget {
+			targets := []DiscoveredTarget{
+				DiscoveredTarget{ID: "W", Type: "service_worker", Title: "Worker", URL: "http://a/sw.js", WebSocketDebuggerURL: "ws://unreachable:1/devtools/page/W"},
+				DiscoveredTarget{ID: "A", Type: "page", Title: "Alpha", URL: "http://a/", WebSocketDebuggerURL: "ws://unreachable:1/devtools/page/A"},
+				DiscoveredTarget{ID: "B", Type: "page", Title: "Beta", URL: "http://b/page", WebSocketDebuggerURL: "ws://unreachable:1/devtools/page/B"},
+			}
+			mu.Lock()
+			if navigated {
+				targets[2].Title, targets[2].URL = "Gamma", "http://c/"
+			}
+			mu.Unlock()
+			return targets
+		},
+		Version: func(host string) string {
+			return "ws://unreachable:1/devtools/browser/X"
+		},
+		Accept: func(r *http.Request) int {
+			if r.Header.Get("Authorization") != "Bearer secret" {
+				return http.StatusUnauthorized
+			}
+			mu.Lock()
+			last = r.URL.Path
+			mu.Unlock()
+			return 0
+		},
+	}, func(c *websocket.Conn, m Message) {
+		if m.Method == page.CommandPageStopLoading {
+			mu.Lock()
+			navigated = true
+			mu.Unlock()
+			c.Close()
+			return
+		}
+		if err := c.WriteJSON(map[string]interface{}{"id": m.ID, "result": map[string]string{}}); err != nil {
+			t.Error(err)
+		}
+	})
+	return srv, func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		return last
+	}
+}
+
+func TestConnect(t *testing.T) {
+	srv, last := ServeEndpoint(t, false)
+	defer srv.Close()
+	tlsSrv, tlsLast := ServeEndpoint(t, true)
+	defer tlsSrv.Close()
+
+	header := http.Header{"Authorization": []string{"Bearer secret"}}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	tests := []struct {
+		endpoint string
+		opts     ConnectOptions
+		path     func() string
+		want     string
+	}{
+		{srv.URL, ConnectOptions{Header: header}, last, "/devtools/page/A"},
+		{srv.URL + "/", ConnectOptions{Header: header, TargetTitle: "Beta"}, last, "/devtools/page/B"},
+		{srv.URL, ConnectOptions{Header: header, TargetURL: "b/page"}, last, "/devtools/page/B"},
+		{srv.URL, ConnectOptions{Header: header, Match: func(t DiscoveredTarget) bool { return t.ID == "W" }}, last, "/devtools/page/W"},
+		{srv.URL, ConnectOptions{Header: header, Browser: true}, last, "/devtools/browser/X"},
+		{"ws" + strings.TrimPrefix(srv.URL, "http") + "/devtools/page/B", ConnectOptions{Header: header}, last, "/devtools/page/B"},
+		{tlsSrv.URL, ConnectOptions{Header: header, TargetTitle: "Beta", TLSConfig: tlsSrv.Client().Transport.(*http.Transport).TLSClientConfig}, tlsLast, "/devtools/page/B"},
+	}
+	for _, test := range tests {
+		frame, err := Connect(ctx, test.endpoint, test.opts)
+		if err != nil {
+			t.Fatalf("%s %+v: %s", test.endpoint, test.opts, err)
+		}
+		err = NewAction([]Event{}, []Command{
+			Command{ID: frame.RequestID.GetNext(), Method: page.CommandPageBringToFront, Params: &page.BringToFrontArgs{}, Reply: &page.BringToFrontReply{}, Timeout: time.Second},
+		}).Run(frame)
+		frame.Stop(false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if path := test.path(); path != test.want {
+			t.Fatalf("Expecting a connection to %s but got %s", test.want, path)
+		}
+	}
+
+	if _, err := Connect(ctx, srv.URL, ConnectOptions{Header: header, TargetTitle: "Gamma"}); !errors.Is(err, ErrTargetNotFound) {
+		t.Fatalf("Expecting no matching target but got %v", err)
+	}
+	if _, err := Connect(ctx, srv.URL, ConnectOptions{}); err == nil {
+		t.Fatal("Expecting the handshake without credentials to fail")
+	}
+	if _, err := Connect(ctx, tlsSrv.URL, ConnectOptions{Header: header}); err == nil {
+		t.Fatal("Expecting an untrusted certificate to fail")
+	}
+	if _, err := Connect(ctx, "localhost:9222", ConnectOptions{}); err == nil {
+		t.Fatal("Expecting an endpoint without a scheme to fail")
+	}
+}
+
+func TestConnectOptions(t *testing.T) {
+	srv, last := ServeEndpoint(t, false)
+	defer srv.Close()
+
+	var mu sync.Mutex
+	records := []string{}
+	states := make(chan ConnState, 10)
+	frame, err := Connect(context.Background(), srv.URL, ConnectOptions{
+		Header:      http.Header{"Authorization": []string{"Bearer secret"}},
+		TargetTitle: "Beta",
+		LogLevel:    LogBasic,
+		Logger: LoggerFunc(func(level LogLevelValue, msg string, fields ...Field) {
+			mu.Lock()
+			records = append(records, msg)
+			mu.Unlock()
+		}),
+		Reconnect: &ReconnectPolicy{Attempts: 3, Backoff: time.Millisecond * 10, Timeout: time.Second},
+		OnState: func(state ConnState, err error) {
+			states <- state
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer frame.Stop(false)
+
+	run := func(method string, params json.Marshaler, reply CommandReply) error {
+		return NewAction([]Event{}, []Command{
+			Command{ID: frame.RequestID.GetNext(), Method: method, Params: params, Reply: reply, Timeout: time.Second},
+		}).Run(frame)
+	}
+	// The page no longer matches the options once it navigated but the frame reconnects to it.
+	if err := run(page.CommandPageStopLoading, &page.StopLoadingArgs{}, &page.StopLoadingReply{}); !errors.Is(err, ErrConnectionReset) {
+		t.Fatalf("Expecting a connection reset error but got %v", err)
+	}
+	for _, want := range []ConnState{ConnReconnecting, ConnConnected} {
+		select {
+		case state := <-states:
+			if state != want {
+				t.Fatalf("Expecting state %s but got %s", want, state)
+			}
+		case <-time.After(time.Second * 2):
+			t.Fatalf("Expecting state %s", want)
+		}
+	}
+	if err := run(page.CommandPageBringToFront, &page.BringToFrontArgs{}, &page.BringToFrontReply{}); err != nil {
+		t.Fatal(err)
+	}
+	if path := last(); path != "/devtools/page/B" {
+		t.Fatalf("Expecting a connection to /devtools/page/B but got %s", path)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(records) == 0 {
+		t.Fatal("Expecting records to go to the logger")
+	}
+}
@@ -0,0 +1,84 @@
+package cdp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrTimeout is returned when a command or event was not completed in time.
+	ErrTimeout = errors.New("timeout")
+	// ErrConnectionClosed is returned when the websocket connection to the browser is closed while an action is active.
+	ErrConnectionClosed = errors.New("connection closed")
+	// ErrNodeNotFound is returned when a search of the DOM does not find a matching node.
+	ErrNodeNotFound = errors.New("node not found")
+	// ErrNavigationFailed is returned when the browser reports that a navigation did not succeed.
+	ErrNavigationFailed = errors.New("navigation failed")
+	// ErrBrowserExited is returned when the browser process exits while it is in use.
+	ErrBrowserExited = errors.New("browser exited")
+	// ErrConnectionReset is returned for actions that were running when the connection dropped, or that were started while it is being recovered, on a frame with a ReconnectPolicy.
+	ErrConnectionReset = errors.New("connection reset")
+	// ErrTargetNotFound is returned by Connect when the endpoint lists no target that matches the options.
+	ErrTargetNotFound = errors.New("target not found")
+	// ErrSlowConsumer is the error of a subscription that was removed because its handler did not keep up with its events.
+	ErrSlowConsumer = errors.New("slow consumer")
+)
+
+// The phases of an action that can time out.
+const (
+	PhaseCommand = "command" // Waiting on the reply to a command.
+	PhaseEvents  = "events"  // Waiting on required events after every command completed.
+	PhaseAction  = "action"  // The action as a whole.
+)
+
+// TimeoutError is returned when a phase of an action did not finish in time.  It matches ErrTimeout with errors.Is.
+// It holds the state of the action when it timed out along with the latest messages received over the connection.
+type TimeoutError struct {
+	Phase        string        // PhaseCommand, PhaseEvents, or PhaseAction.
+	Timeout      time.Duration // The timeout of the phase that expired.
+	Elapsed      time.Duration // The time since the action started.
+	Method       string        // The method of the active command or, once every command completed, of the last command.
+	Command      []byte        // The encoded command.
+	CommandIndex int           // The index of the active command, which equals Commands once every command completed.
+	Commands     int           // The number of commands of the action.
+	Missing      []string      // The required events that were not found.
+	Matched      []string      // The events that had at least one matching occurrence.
+
+	// Messages are the latest raw messages received over the connection, oldest first.  See MessageHistory.
+	Messages []json.RawMessage
+}
+
+// Error satisfies the error interface.  The received messages are only included by Diagnostics.
+func (e *TimeoutError) Error() string {
+	progress := fmt.Sprintf("command %d of %d", e.CommandIndex+1, e.Commands)
+	if e.CommandIndex == e.Commands {
+		progress = fmt.Sprintf("all %d commands complete", e.Commands)
+	}
+	msg := fmt.Sprintf("%s %s after %s (elapsed %s, %s) %s", e.Phase, ErrTimeout, e.Timeout, e.Elapsed.Round(time.Millisecond), progress, e.Command)
+	if len(e.Missing) > 0 {
+		msg = fmt.Sprintf("%s waiting on %s", msg, strings.Join(e.Missing, ", "))
+	}
+	if len(e.Matched) > 0 {
+		msg = fmt.Sprintf("%s matched %s", msg, strings.Join(e.Matched, ", "))
+	}
+	return msg
+}
+
+// Diagnostics returns the error followed by the latest received messages, one per line.
+func (e *TimeoutError) Diagnostics() string {
+	b := &strings.Builder{}
+	b.WriteString(e.Error())
+	fmt.Fprintf(b, "\nlast %d received messages:", len(e.Messages))
+	for _, m := range e.Messages {
+		fmt.Fprintf(b, "\n%s", m)
+	}
+	return b.String()
+}
+
+// Is reports that the error is an ErrTimeout.
+func (e *TimeoutError) Is(target error) bool {
+	return target == ErrTimeout
+}
@@ -9,15 +9,25 @@ import (
 )
 
 func main() {
-	browser := cdp.NewBrowser("/usr/bin/google-chrome", 9222, "runtime.log")
+	browser, err := cdp.NewBrowser("/usr/bin/google-chrome", 9222, "runtime.log")
+	if err != nil {
+		panic(err)
+	}
 
-	frame := cdp.Start(browser, cdp.LogBasic)
+	frame, err := cdp.Start(browser, cdp.LogBasic)
+	if err != nil {
+		panic(err)
+	}
 	defer func() {
-		frame.Stop(false)
+		if err := frame.Stop(false); err != nil {
+			log.Print(err)
+		}
 
 		// Give yourself time to view the final page in the browser.
 		time.Sleep(3 * time.Second)
-		browser.Stop()
+		if err := browser.Stop(); err != nil {
+			log.Print(err)
+		}
 	}()
 
 	// Enable page and dom events
@@ -1,10 +1,12 @@
 package cdp
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"github.com/4ydx/cdp/protocol/dom"
-	"github.com/gorilla/websocket"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -18,35 +20,193 @@ type Frame struct {
 
 	Browser *Browser
 
-	// Conn is the connection to the websocket.
-	Conn *websocket.Conn
+	// TargetID and SessionID identify the attached target when the frame is a session of another frame.
+	TargetID  string
+	SessionID string
 
-	// AllComplete will trigger a close on the websocket.
-	// Typically AllComplete or the OsInterrupt channels will fire and the write loop will send a request to close the socket.
+	// Sessions stores the session Frames attached through this frame's connection keyed by session id.
+	Sessions map[string]*Frame
+
+	// parent is the frame that owns the connection of a session frame.
+	parent *Frame
+
+	// Transport carries the messages of the frame and its sessions to the browser.
+	Transport Transport
+
+	// AllComplete is closed by Close to end the write loop.
 	AllComplete chan struct{}
 
-	// CacheCompleteChan sends the signal that the cached action is completed (all commands and events).
-	CacheCompleteChan chan struct{}
+	// actionChan carries commands to the write loop.  It buffers up to SendQueue commands so that the read loop does not wait on the write loop.
+	actionChan chan outgoing
+
+	// Actions stores the Actions that are currently active in the order that they were started.
+	Actions []*Action
+
+	// Pending stores the currently active Actions keyed by the ID of the command that each Action is waiting on.
+	Pending map[int64]*Action
+
+	// Subscriptions stores the persistent event subscriptions keyed by event method name.
+	Subscriptions map[string][]*Subscription
+
+	// Retry specifies which protocol errors cause a command to be sent again.  When nil, protocol errors are returned immediately.
+	Retry *RetryPolicy
+
+	// recorder writes the messages of the connection to a transcript when set.
+	recorder *Recorder
+
+	// readDone is closed once the read loop of a root frame returns.
+	readDone chan struct{}
+
+	// writeDone is closed once the write loop of a root frame returns.  Commands are no longer taken from actionChan after that.
+	writeDone chan struct{}
+
+	// Reconnect redials a dropped connection when set.  Only the frame that owns the connection uses it.
+	// The loops read it without the lock, so it is set through StartOptions or ConnectOptions and not changed afterwards.
+	Reconnect *ReconnectPolicy
+
+	// OnState is called with each change of the connection's state and the error that caused it, if any.  It is called from the frame's goroutines and should return quickly.
+	// Like Reconnect it is set through StartOptions or ConnectOptions.
+	OnState func(state ConnState, err error)
+
+	// state holds the ConnState of a root frame and generation counts its reconnects.
+	state      int32
+	generation int64
 
-	// CommandChan sends the signal that a command has been completed and an Action can advance.
-	CommandChan chan (<-chan time.Time)
+	// logSessionID holds the SessionID for log, which runs both with and without the frame's lock held while a reconnect may change the id.
+	logSessionID atomic.Value
 
-	// ActionChan sends Actions to the websocket.
-	ActionChan chan []byte
+	// dial connects to the endpoint that the frame was started with again.
+	dial func() (Transport, error)
 
-	// CurrentAction stores the Action that is currently active.
-	CurrentAction *Action
+	// enabled stores the completed commands that enabled a domain, in order, to be replayed after a reconnect.
+	enabled []Command
 
-	// LogLevel specifies how much information should be f.Browser.Logged. Higher number results in more data.
+	// closeOnce and transportOnce make sure that Close only ends the loops and closes the transport once.  closeErr keeps the result for later calls.
+	closeOnce     sync.Once
+	transportOnce sync.Once
+	closeErr      error
+
+	// QueueSize bounds the events that each new subscription queues for its handler.  Zero leaves the queue unbounded.
+	QueueSize int
+
+	// SlowConsumer decides what happens to an event that arrives while a subscription's queue is full.
+	SlowConsumer SlowConsumerPolicy
+
+	// history keeps the latest messages received by the read loop of a root frame.
+	history *history
+
+	// LogLevel specifies how much information should be logged. Higher number results in more data.
 	LogLevel LogLevelValue
+
+	// Logger receives the frame's records up to LogLevel.  When nil the records go to the browser's logger.
+	Logger Logger
+
+	// Instrumentation receives the timing of the frame's commands, events, and actions when set.
+	Instrumentation Instrumentation
+}
+
+// AddAction adds the action to the actions that the frame is evaluating and sends its first command.
+func (f *Frame) AddAction(act *Action) error {
+	if !act.recovery {
+		if err := f.stateError(); err != nil {
+			return err
+		}
+	}
+	if err := f.build(act); err != nil {
+		return err
+	}
+	f.Lock()
+	j, err := f.toJSON(act)
+	if err != nil {
+		f.Unlock()
+		return err
+	}
+	f.Actions = append(f.Actions, act)
+	f.Pending[act.Commands[act.CommandIndex].ID] = act
+	act.sent = time.Now()
+	if act.started.IsZero() {
+		act.started = act.sent
+	}
+	o := outgoing{message: j, frame: f, act: act, info: f.commandInfo(act, act.command()), queued: act.sent}
+	f.Unlock()
+
+	if err := f.send(o); err != nil {
+		f.RemoveAction(act)
+		return err
+	}
+	return nil
+}
+
+// outgoing is a command on its way to the write loop.  The write loop reports it to the frame's instrumentation once the transport has sent it.
+type outgoing struct {
+	message []byte
+	frame   *Frame
+	act     *Action
+	info    CommandInfo
+	queued  time.Time
+}
+
+// send waits for room in the send queue.  It returns ErrConnectionClosed once the write loop has returned.
+func (f *Frame) send(o outgoing) error {
+	select {
+	case <-f.writeDone:
+		return ErrConnectionClosed
+	default:
+	}
+	select {
+	case f.actionChan <- o:
+		return nil
+	case <-f.writeDone:
+		return ErrConnectionClosed
+	}
+}
+
+// enqueue hands the action's next command to the write loop without blocking the caller.
+// When the send queue is full the command waits in its own goroutine and the action fails if the write loop returns first.
+func (f *Frame) enqueue(act *Action, j []byte, info CommandInfo) {
+	o := outgoing{message: j, frame: f, act: act, info: info, queued: time.Now()}
+	select {
+	case f.actionChan <- o:
+		return
+	default:
+	}
+	go func() {
+		if err := f.send(o); err != nil {
+			f.Lock()
+			f.failAction(act, err)
+			f.Unlock()
+		}
+	}()
 }
 
-// SetCurrentAction sets the current action that the frame is evaluating.
-func (f *Frame) SetCurrentAction(act *Action) {
+// RemoveAction stops the frame from evaluating the action.  Any later replies to the action's commands are ignored.
+func (f *Frame) RemoveAction(act *Action) {
 	f.Lock()
 	defer f.Unlock()
-	f.CurrentAction = act
-	f.ActionChan <- f.toJSON()
+	f.removeAction(act)
+}
+
+func (f *Frame) isActive(act *Action) bool {
+	for _, a := range f.Actions {
+		if a == act {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *Frame) removeAction(act *Action) {
+	for i, a := range f.Actions {
+		if a == act {
+			f.Actions = append(f.Actions[:i], f.Actions[i+1:]...)
+			break
+		}
+	}
+	for id, a := range f.Pending {
+		if a == act {
+			delete(f.Pending, id)
+		}
+	}
 }
 
 // SetDOM allows for setting the Frame DOM value safely.
@@ -150,211 +310,582 @@ func (f *Frame) GetFrameID() string {
 	return f.FrameID
 }
 
-// Stop closes used resources.
-func (f *Frame) Stop(closeBrowser bool) {
-	defer func() {
-		err := f.Conn.Close()
-		if err != nil {
-			panic(err)
+// Stop closes the frame and, when closeBrowser is set, stops the browser.
+func (f *Frame) Stop(closeBrowser bool) error {
+	err := f.Close(context.Background())
+	if closeBrowser && f.Browser != nil && !f.IsSession() {
+		if e := f.Browser.Stop(); err == nil {
+			err = e
 		}
-		if closeBrowser && f.Browser != nil {
-			f.Browser.Stop()
+	}
+	return err
+}
+
+// Close fails the active actions with ErrConnectionClosed, waits for the write loop to return, closes the transport, and waits for the read loop to return.
+// It returns the error of closing the transport, or the context's error when a loop is still running once the context is done.
+// Close may be called again, for instance after its context expired, and returns the same transport error once the loops are done.
+// Closing a session only stops routing messages to it since the connection belongs to the parent frame.
+func (f *Frame) Close(ctx context.Context) error {
+	if f.IsSession() {
+		f.parent.RemoveSession(f.SessionID)
+		return nil
+	}
+	f.closeOnce.Do(func() {
+		for _, session := range f.GetSessions() {
+			f.RemoveSession(session.SessionID)
 		}
-	}()
-	f.AllComplete <- struct{}{}
+		f.removeSubscriptions()
+		if f.AllComplete != nil {
+			close(f.AllComplete)
+		}
+		f.setState(ConnClosed, nil)
+		f.failAll(fmt.Errorf("%w: frame closed", ErrConnectionClosed))
+	})
+
+	// The transport is closed after the write loop returns so that a send is never interrupted midway.
+	if err := wait(ctx, f.writeDone); err != nil {
+		return err
+	}
+	f.transportOnce.Do(func() {
+		t := f.transport()
+		if t == nil {
+			return
+		}
+		f.closeErr = t.Close()
+		if f.closeErr != nil {
+			f.log(LogError, "close: "+f.closeErr.Error())
+		}
+	})
+	if err := wait(ctx, f.readDone); err != nil {
+		return err
+	}
+	return f.closeErr
 }
 
-// IsCommandComplete indicates that all commands are complete.
-func (f *Frame) IsCommandComplete() bool {
+// wait returns once done is closed or with the context's error once the context is done first.  A nil channel is not waited on.
+func wait(ctx context.Context, done chan struct{}) error {
+	if done == nil {
+		return nil
+	}
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// closing indicates that Close has been called on the frame.
+func (f *Frame) closing() bool {
+	select {
+	case <-f.AllComplete:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsCommandComplete indicates that all commands of the action are complete.
+func (f *Frame) IsCommandComplete(act *Action) bool {
 	f.RLock()
 	defer f.RUnlock()
 
-	return f.CurrentAction.CommandIndex == len(f.CurrentAction.Commands)
+	return act.isCommandComplete()
 }
 
-// IsComplete indicates that all commands and events are complete.
-func (f *Frame) IsComplete() bool {
+// IsComplete indicates that all commands and events of the action are complete.
+func (f *Frame) IsComplete(act *Action) bool {
 	f.RLock()
 	defer f.RUnlock()
 
-	complete := true
-	for _, e := range f.CurrentAction.Events {
-		if e.IsRequired && !e.IsFound {
-			complete = false
-		}
-	}
-	return f.CurrentAction.CommandIndex == len(f.CurrentAction.Commands) && complete
+	return act.isComplete()
 }
 
-// CommandTimeout once timed out will trigger an error and stop the automation.
-func (f *Frame) CommandTimeout() <-chan time.Time {
+// CommandTimeout once timed out will trigger an error and stop the action.
+func (f *Frame) CommandTimeout(act *Action) <-chan time.Time {
 	f.RLock()
 	defer f.RUnlock()
 
-	return time.After(f.CurrentAction.Commands[f.CurrentAction.CommandIndex].Timeout)
+	return time.After(act.Commands[act.CommandIndex].Timeout)
 }
 
-// ToJSON encodes the current command.  This is the chrome devtools protocol request.
+// ToJSON encodes the action's current command.  This is the chrome devtools protocol request.
 // In the event that all commands are complete, continue to display the last command for debugging convenience.
-func (f *Frame) ToJSON() []byte {
+func (f *Frame) ToJSON(act *Action) ([]byte, error) {
 	f.RLock()
 	defer f.RUnlock()
-	return f.toJSON()
+	return f.toJSON(act)
+}
+
+// build sets the params of the action's current command when they are built from the replies of the earlier commands.
+// The frame's lock must not be held.  Build runs on a copy of the earlier commands without the lock so that it may use the frame.
+func (f *Frame) build(act *Action) error {
+	f.RLock()
+	index := act.CommandIndex
+	build := act.Commands[index].Build
+	previous := append([]Command{}, act.Commands[:index]...)
+	f.RUnlock()
+
+	if build == nil {
+		return nil
+	}
+	params, err := build(previous)
+	if err != nil {
+		return err
+	}
+	f.Lock()
+	act.Commands[index].Params = params
+	f.Unlock()
+	return nil
 }
 
-func (f *Frame) toJSON() []byte {
-	index := f.CurrentAction.CommandIndex
-	if f.CurrentAction.CommandIndex == len(f.CurrentAction.Commands) {
-		index--
+// timeoutError describes the phase of the action that timed out.
+func (f *Frame) timeoutError(act *Action, phase string) error {
+	f.RLock()
+	defer f.RUnlock()
+
+	e := &TimeoutError{
+		Phase:        phase,
+		Method:       act.command().Method,
+		CommandIndex: act.CommandIndex,
+		Commands:     len(act.Commands),
+		Elapsed:      time.Since(act.started),
+		Messages:     f.received(),
+	}
+	e.Command, _ = f.toJSON(act)
+	groups := act.groups()
+	for _, name := range act.names {
+		ev := act.Events[name]
+		if ev.Found > 0 {
+			e.Matched = append(e.Matched, name)
+		}
+		// The alternatives of a group that is already done are not missing.
+		if ev.IsRequired && !ev.done(act) && (ev.Group == "" || !groups[ev.Group]) {
+			e.Missing = append(e.Missing, name)
+		}
 	}
-	s := f.CurrentAction.Commands[index]
+	switch {
+	case phase == PhaseAction:
+		e.Timeout = act.Timeout
+	case phase == PhaseEvents && act.EventTimeout > 0:
+		e.Timeout = act.EventTimeout
+	default:
+		e.Timeout = act.command().Timeout
+	}
+	return e
+}
 
-	j, err := json.Marshal(s)
+func (f *Frame) toJSON(act *Action) ([]byte, error) {
+	c := act.command()
+	c.SessionID = f.SessionID
+	j, err := json.Marshal(c)
 	if err != nil {
-		f.Browser.Log.Fatal(err)
+		f.log(LogError, err.Error(), Field{FieldMethod, c.Method}, Field{FieldCommandID, c.ID})
 	}
-	return j
+	return j, err
 }
 
-// Log writes the current state of the action to the f.Browser.Log.
+// Log writes the current state of the active actions to the frame's logger.
 func (f *Frame) Log() {
 	f.RLock()
 	defer f.RUnlock()
 
-	f.Browser.Log.Printf("Frame %+v\n", f.CurrentAction)
-	for i, command := range f.CurrentAction.Commands {
-		f.Browser.Log.Printf("%d Command %d Params %+v", i, command.ID, command.Params)
-		f.Browser.Log.Printf("%d Command %d Return %+v", i, command.ID, command.Reply)
+	for _, act := range f.Actions {
+		f.log(LogBasic, fmt.Sprintf("action %+v", act), Field{FieldFrameID, f.FrameID})
+		for i, command := range act.Commands {
+			f.log(LogBasic, fmt.Sprintf("%d params %+v", i, command.Params), Field{FieldMethod, command.Method}, Field{FieldCommandID, command.ID})
+			f.log(LogBasic, fmt.Sprintf("%d reply %+v", i, command.Reply), Field{FieldMethod, command.Method}, Field{FieldCommandID, command.ID})
+		}
 	}
 }
 
-// HasCommandID determines if an id matches the current action's command's unique id.
-func (f *Frame) HasCommandID(id int64) bool {
+// LogAt writes the record to the frame's logger when the level is within the frame's LogLevel.
+// The frame id and session id of the frame are added to the fields.
+func (f *Frame) LogAt(level LogLevelValue, msg string, fields ...Field) {
+	if level > f.LogLevel {
+		return
+	}
 	f.RLock()
-	defer f.RUnlock()
+	frameID := f.FrameID
+	f.RUnlock()
 
-	if f.CurrentAction.CommandIndex == len(f.CurrentAction.Commands) {
-		return false
+	f.log(level, msg, append([]Field{{FieldFrameID, frameID}}, fields...)...)
+}
+
+// LogError writes the error to the frame's logger.
+func (f *Frame) LogError(err error, fields ...Field) {
+	f.LogAt(LogError, err.Error(), fields...)
+}
+
+// log writes the record without taking the frame's lock.  Callers add the frame id themselves when they hold the lock.
+func (f *Frame) log(level LogLevelValue, msg string, fields ...Field) {
+	if level > f.LogLevel {
+		return
+	}
+	if sessionID, _ := f.logSessionID.Load().(string); sessionID != "" {
+		fields = append(fields, Field{FieldSessionID, sessionID})
 	}
-	return f.CurrentAction.Commands[f.CurrentAction.CommandIndex].ID == id
+	f.logger().Log(level, msg, fields...)
 }
 
-// HasEvent returns true when the action has an event with the given MethodType.
-func (f *Frame) HasEvent(name string) bool {
+// logger returns the frame's logger, falling back to the browser's logger.
+func (f *Frame) logger() Logger {
+	if f.Logger != nil {
+		return f.Logger
+	}
+	return f.Browser.logger()
+}
+
+// GetCommandAction returns the active action that is waiting on a reply for the given command id.
+func (f *Frame) GetCommandAction(id int64) *Action {
 	f.RLock()
 	defer f.RUnlock()
 
-	_, ok := f.CurrentAction.Events[name]
-	return ok
+	return f.Pending[id]
 }
 
-// GetCommandMethod returns the method of the command that is currently active or the very last method.
-func (f *Frame) GetCommandMethod() string {
+// GetEventActions returns the active actions that have an event with the given MethodType.
+func (f *Frame) GetEventActions(name string) []*Action {
 	f.RLock()
 	defer f.RUnlock()
 
-	if f.CurrentAction.CommandIndex == len(f.CurrentAction.Commands) {
-		return f.CurrentAction.Commands[f.CurrentAction.CommandIndex-1].Method
+	acts := []*Action{}
+	for _, act := range f.Actions {
+		if _, ok := act.Events[name]; ok {
+			acts = append(acts, act)
+		}
 	}
-	return f.CurrentAction.Commands[f.CurrentAction.CommandIndex].Method
+	return acts
 }
 
-// SetEvent takes the given message and sets an event's params or results's.
-func (f *Frame) SetEvent(frame *Frame, name string, m Message) error {
+// GetCommandMethod returns the method of the action's command that is currently active or the very last method.
+func (f *Frame) GetCommandMethod(act *Action) string {
+	f.RLock()
+	defer f.RUnlock()
+
+	return act.command().Method
+}
+
+// SetEvent takes the given message and sets the action's event params or results's.
+// The event value is returned when the message was intended for the current Frame.
+func (f *Frame) SetEvent(act *Action, name string, m Message) (CommandReply, error) {
 	f.Lock()
 	defer f.Unlock()
 
 	// Attempt to compare the incoming Event's frameID value with the existing value.
-	if e, ok := f.CurrentAction.Events[name]; ok {
-		if frame.FrameID == "" {
-			f.Browser.Log.Println(".ERR FrameID is empty during event processing.")
-			if len(m.Params) > 0 {
-				err := e.Value.UnmarshalJSON(m.Params)
-				if err != nil {
-					f.Browser.Log.Printf("Unmarshal params error: %s; for %+v; from %+v", err.Error(), e.Value, m.Params)
-					return err
-				}
-			} else {
-				err := e.Value.UnmarshalJSON(m.Result)
+	e, ok := act.Events[name]
+	if !ok || !f.isActive(act) {
+		return nil, nil
+	}
+	v := e.next()
+	if f.FrameID == "" {
+		f.log(LogDetails, "frame id is empty during event processing", Field{FieldMethod, name})
+		if len(m.Params) > 0 {
+			err := v.UnmarshalJSON(m.Params)
+			if err != nil {
+				f.log(LogError, "unmarshal params: "+err.Error(), Field{FieldMethod, name}, Field{FieldMessage, string(m.Params)})
+				return nil, err
+			}
+		} else {
+			err := v.UnmarshalJSON(m.Result)
+			if err != nil {
+				f.log(LogError, "unmarshal result: "+err.Error(), Field{FieldMethod, name}, Field{FieldMessage, string(m.Result)})
+				return nil, err
+			}
+		}
+	} else {
+		if len(m.Params) > 0 {
+			if ok, err := v.MatchFrameID(f.FrameID, m.Params); !ok {
 				if err != nil {
-					f.Browser.Log.Printf("Unmarshal result error: %s; for %+v; from %+v", err.Error(), e.Value, m.Result)
-					return err
+					f.log(LogError, "unmarshal: "+err.Error(), Field{FieldMethod, name}, Field{FieldFrameID, f.FrameID})
+					return nil, err
 				}
+				// When the frameID does not match, it is definitely not intended for the current Frame.
+				f.log(LogDetails, "no matching frame id", Field{FieldMethod, name}, Field{FieldFrameID, f.FrameID}, Field{FieldMessage, string(m.Params)})
+				return nil, nil
 			}
 		} else {
-			if len(m.Params) > 0 {
-				if ok, err := e.Value.MatchFrameID(frame.FrameID, m.Params); !ok {
-					if err != nil {
-						f.Browser.Log.Printf("Unmarshal error: %s", err)
-						return err
-					}
-					// When the frameID does not match, it is definitely not intended for the current Frame.
-					f.Browser.Log.Printf("No matching frameID %s %s", m.Method, m.Params)
-					return nil
-				}
-			} else {
-				if ok, err := e.Value.MatchFrameID(frame.FrameID, m.Result); !ok {
-					if err != nil {
-						f.Browser.Log.Printf("Unmarshal error: %s", err)
-						return err
-					}
-					f.Browser.Log.Printf("No matching frameID %s %s", m.Method, m.Result)
-					return nil
+			if ok, err := v.MatchFrameID(f.FrameID, m.Result); !ok {
+				if err != nil {
+					f.log(LogError, "unmarshal: "+err.Error(), Field{FieldMethod, name}, Field{FieldFrameID, f.FrameID})
+					return nil, err
 				}
+				f.log(LogDetails, "no matching frame id", Field{FieldMethod, name}, Field{FieldFrameID, f.FrameID}, Field{FieldMessage, string(m.Result)})
+				return nil, nil
 			}
 		}
-		UpdateDOMEvent(frame, m.Method, e.Value)
+	}
+	if e.Match != nil {
+		// The predicate runs without the lock so that it may use the frame.  Match always gets a new value, so v is not shared.
+		f.Unlock()
+		matched := e.Match(v)
+		f.Lock()
+		if !matched {
+			f.log(LogDetails, "event did not match", Field{FieldMethod, name}, Field{FieldFrameID, f.FrameID})
+			return v, nil
+		}
+		if e, ok = act.Events[name]; !ok || !f.isActive(act) {
+			return nil, nil
+		}
+	}
+	v = e.keep(v)
+	e.Found++
+	e.IsFound = e.Found >= e.required()
+	e.last = time.Now()
+	if e.Collect {
+		e.Values = append(e.Values, v)
+	}
+	act.Events[name] = e
+	if e.Quiet > 0 {
+		f.checkAfter(act, e.Quiet)
+	}
 
-		e.IsFound = true
-		f.CurrentAction.Events[string(name)] = e
+	if f.Instrumentation != nil {
+		f.Instrumentation.EventMatched(EventInfo{
+			Method:        name,
+			SessionID:     f.SessionID,
+			FrameID:       f.FrameID,
+			CommandMethod: act.command().Method,
+			Duration:      time.Since(act.started),
+		})
+	}
 
-		f.Browser.Log.Printf(".EVT: %s %+v\n", name, m)
-		if frame.LogLevel >= LogDetails {
-			f.Browser.Log.Printf("    : %+v\n", e)
-			f.Browser.Log.Printf("    : %+v\n", e.Value)
-		}
+	f.log(LogBasic, "event", Field{FieldMethod, name}, Field{FieldFrameID, f.FrameID}, Field{FieldDirection, DirectionReceive})
+	if f.LogLevel >= LogDetails {
+		f.log(LogDetails, fmt.Sprintf("event value %+v", v), Field{FieldMethod, name}, Field{FieldFrameID, f.FrameID})
 	}
-	return nil
+	return v, nil
 }
 
-// SetResult applies the message returns to the current command and advances the command.
-func (f *Frame) SetResult(frame *Frame, m Message) error {
+// SetResult applies the message returns to the action's current command and advances the command.
+// True is returned when the command was advanced.
+func (f *Frame) SetResult(act *Action, m Message) (bool, error) {
 	f.Lock()
 	defer f.Unlock()
 
-	s := f.CurrentAction.Commands[f.CurrentAction.CommandIndex]
-	if frame.FrameID == "" {
+	if !f.isActive(act) {
+		// The action timed out or was cancelled while the reply was arriving.
+		return false, nil
+	}
+	s := act.Commands[act.CommandIndex]
+	if f.FrameID == "" {
 		err := s.Reply.UnmarshalJSON(m.Result)
 		if err != nil {
-			f.Browser.Log.Printf("Unmarshal error: %s", err)
-			return err
+			f.log(LogError, "unmarshal: "+err.Error(), Field{FieldMethod, s.Method}, Field{FieldCommandID, s.ID})
+			return false, err
 		}
-		frame.FrameID = s.Reply.GetFrameID()
+		f.FrameID = s.Reply.GetFrameID()
 	} else {
-		if ok, err := s.Reply.MatchFrameID(frame.FrameID, m.Result); !ok {
+		if ok, err := s.Reply.MatchFrameID(f.FrameID, m.Result); !ok {
 			if err != nil {
-				f.Browser.Log.Printf("Unmarshal error: %s", err)
-				return err
-			} else {
-				f.Browser.Log.Printf("No matching frameID")
-				return nil
+				f.log(LogError, "unmarshal: "+err.Error(), Field{FieldMethod, s.Method}, Field{FieldCommandID, s.ID})
+				return false, err
 			}
+			f.log(LogDetails, "no matching frame id", Field{FieldMethod, s.Method}, Field{FieldCommandID, s.ID}, Field{FieldFrameID, f.FrameID})
+			return false, nil
 		}
 	}
-	f.CurrentAction.CommandIndex++
+	if f.Instrumentation != nil {
+		info := f.commandInfo(act, s)
+		info.Duration = act.latency(s)
+		f.Instrumentation.ReplyReceived(info)
+	}
+	delete(f.Pending, s.ID)
+	f.remember(s)
+	act.CommandIndex++
+	act.retries = 0
+	if !act.isCommandComplete() {
+		f.Pending[act.Commands[act.CommandIndex].ID] = act
+	} else {
+		act.commandsDone = time.Now()
+	}
 
-	f.Browser.Log.Printf(".STP COMPLETE: %+v\n", s)
-	if frame.LogLevel >= LogDetails {
-		f.Browser.Log.Printf("             : %+v\n", s.Params)
-		f.Browser.Log.Printf("             : %+v\n", s.Reply)
+	f.log(LogBasic, "command complete", Field{FieldMethod, s.Method}, Field{FieldCommandID, s.ID}, Field{FieldFrameID, f.FrameID}, Field{FieldDuration, time.Since(act.sent)})
+	if f.LogLevel >= LogDetails {
+		f.log(LogDetails, fmt.Sprintf("command params %+v", s.Params), Field{FieldMethod, s.Method}, Field{FieldCommandID, s.ID})
+		f.log(LogDetails, fmt.Sprintf("command reply %+v", s.Reply), Field{FieldMethod, s.Method}, Field{FieldCommandID, s.ID})
 	}
-	return nil
+	act.sent = time.Now()
+	return true, nil
 }
 
-// Clear the action.
-func (f *Frame) Clear() {
+// SetError handles a protocol error sent in reply to the action's current command.
+// The command is sent again when the retry policy allows it.  Otherwise the action fails with the error.
+func (f *Frame) SetError(act *Action, m Message) {
 	f.Lock()
 	defer f.Unlock()
 
-	f.CurrentAction = &Action{}
+	if !f.isActive(act) {
+		return
+	}
+	s := act.Commands[act.CommandIndex]
+	e := *m.Error
+	e.Method = s.Method
+	e.Params = s.Params
+
+	if f.Instrumentation != nil {
+		info := f.commandInfo(act, s)
+		info.Duration = act.latency(s)
+		info.Err = &e
+		f.Instrumentation.ReplyReceived(info)
+	}
+
+	policy := act.Retry
+	if policy == nil {
+		policy = f.Retry
+	}
+	if !policy.allows(e.Code, act.retries) {
+		f.failAction(act, &e)
+		return
+	}
+	delay := policy.delay(act.retries)
+	act.retries++
+	f.log(LogBasic, fmt.Sprintf("retry %d after %s: %s", act.retries, delay, &e), Field{FieldMethod, s.Method}, Field{FieldCommandID, s.ID})
+
+	j, err := f.toJSON(act)
+	if err != nil {
+		f.failAction(act, err)
+		return
+	}
+	info := f.commandInfo(act, s)
+	time.AfterFunc(delay, func() {
+		// The action may have timed out or been cancelled during the backoff.
+		if f.GetCommandAction(s.ID) == act {
+			f.enqueue(act, j, info)
+		}
+	})
+}
+
+// Advance checks the action after one of its commands was completed.
+// A completed action is removed from the frame and otherwise the next command is sent.
+func (f *Frame) Advance(act *Action) {
+	f.Lock()
+	if f.complete(act) {
+		f.Unlock()
+		return
+	}
+	if act.isCommandComplete() {
+		f.log(LogDetails, "action waiting on events", Field{FieldMethod, act.command().Method}, Field{FieldFrameID, f.FrameID})
+		for _, e := range act.Events {
+			if e.IsRequired && e.Quiet > 0 {
+				f.checkAfter(act, e.Quiet)
+			}
+		}
+		eventTimeout := act.EventTimeout
+		f.Unlock()
+
+		if eventTimeout > 0 {
+			act.CommandChan <- time.After(eventTimeout)
+		}
+		return
+	}
+	f.log(LogDetails, "action next command", Field{FieldMethod, act.command().Method}, Field{FieldCommandID, act.command().ID}, Field{FieldFrameID, f.FrameID})
+	f.Unlock()
+
+	if err := f.build(act); err != nil {
+		f.Lock()
+		f.failAction(act, err)
+		f.Unlock()
+		return
+	}
+	f.Lock()
+	// The action may have timed out or been cancelled while its params were built.
+	if !f.isActive(act) {
+		f.Unlock()
+		return
+	}
+	j, err := f.toJSON(act)
+	if err != nil {
+		f.failAction(act, err)
+		f.Unlock()
+		return
+	}
+	timeout := time.After(act.Commands[act.CommandIndex].Timeout)
+	info := f.commandInfo(act, act.command())
+	f.Unlock()
+
+	f.enqueue(act, j, info)
+	act.CommandChan <- timeout
+}
+
+// CheckComplete checks the action after one of its events was matched and removes the action from the frame when it is completed.
+func (f *Frame) CheckComplete(act *Action) {
+	f.Lock()
+	defer f.Unlock()
+	f.complete(act)
+}
+
+// checkAfter checks the action for completion once the duration has passed so that actions waiting on quiet events complete without another message arriving.
+func (f *Frame) checkAfter(act *Action, d time.Duration) {
+	time.AfterFunc(d, func() {
+		f.CheckComplete(act)
+	})
+}
+
+// complete signals a completed action and returns true when the action is no longer active.
+func (f *Frame) complete(act *Action) bool {
+	if !f.isActive(act) {
+		// The action has already been completed or removed.
+		return true
+	}
+	if !act.isComplete() {
+		return false
+	}
+	f.log(LogBasic, "action complete", Field{FieldMethod, act.command().Method}, Field{FieldFrameID, f.FrameID})
+	f.removeAction(act)
+	act.CompleteChan <- struct{}{}
+	return true
+}
+
+// FailAction removes the action from the frame and completes it with the given error.
+func (f *Frame) FailAction(act *Action, err error) {
+	f.Lock()
+	defer f.Unlock()
+	f.failAction(act, err)
+}
+
+func (f *Frame) failAction(act *Action, err error) {
+	if !f.isActive(act) {
+		return
+	}
+	f.log(LogError, "action failed", Field{FieldMethod, act.command().Method}, Field{FieldCommandID, act.command().ID}, Field{FieldFrameID, f.FrameID}, Field{FieldError, err})
+	f.removeAction(act)
+	act.err = err
+	act.CompleteChan <- struct{}{}
+}
+
+// failAll fails the actions of the frame and all of its sessions.
+func (f *Frame) failAll(err error) {
+	for _, session := range f.GetSessions() {
+		session.FailActions(err)
+	}
+	f.FailActions(err)
+}
+
+// watchBrowser fails every action as soon as the browser process exits rather than waiting on command timeouts.
+func (f *Frame) watchBrowser() {
+	select {
+	case <-f.Browser.Done():
+		f.log(LogError, "browser exited", Field{FieldError, f.Browser.Err()})
+		f.failAll(f.browserExited())
+	case <-f.readDone:
+	}
+}
+
+// browserExited is the error for actions that were active when the browser process exited.
+func (f *Frame) browserExited() error {
+	if err := f.Browser.Err(); err != nil {
+		return fmt.Errorf("%w: %s", ErrBrowserExited, err)
+	}
+	return ErrBrowserExited
+}
+
+// FailActions completes every active action with the given error.
+func (f *Frame) FailActions(err error) {
+	f.Lock()
+	defer f.Unlock()
+
+	for _, act := range append([]*Action{}, f.Actions...) {
+		f.failAction(act, err)
+	}
 }
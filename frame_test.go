@@ -0,0 +1,461 @@
+package cdp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/4ydx/cdp/protocol/page"
+	"github.com/gorilla/websocket"
+)
+
+// TestEndpoint configures the devtools endpoint of ServeDevtools.  The zero value lists one page whose websocket, like the browser target's, is /ws.
+type TestEndpoint struct {
+	TLS bool
+
+	// Targets returns the target list of /json for the host of the server.
+	Targets func(host string) []DiscoveredTarget
+
+	// Version returns the websocket url of the browser target listed by /json/version for the host of the server.
+	Version func(host string) string
+
+	// Accept answers a websocket request with the returned status instead of upgrading it when the status is not zero.
+	Accept func(r *http.Request) int
+}
+
+// ServeDevtools starts a devtools endpoint where each command received on any websocket path is passed to the given handler.
+func ServeDevtools(t *testing.T, endpoint TestEndpoint, handler func(c *websocket.Conn, m Message)) (*httptest.Server, int) {
+	mux := http.NewServeMux()
+	srv := httptest.NewUnstartedServer(mux)
+	if endpoint.TLS {
+		srv.StartTLS()
+	} else {
+		srv.Start()
+	}
+	host := srv.Listener.Addr().String()
+	if endpoint.Targets == nil {
+		endpoint.Targets = func(host string) []DiscoveredTarget {
+			return []DiscoveredTarget{DiscoveredTarget{Type: "page", WebSocketDebuggerURL: "ws://" + host + "/ws"}}
+		}
+	}
+	if endpoint.Version == nil {
+		endpoint.Version = func(host string) string {
+			return "ws://" + host + "/ws"
+		}
+	}
+	mux.HandleFunc("/json", func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewEncoder(w).Encode(endpoint.Targets(host)); err != nil {
+			t.Error(err)
+		}
+	})
+	mux.HandleFunc("/json/version", func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewEncoder(w).Encode(DiscoveredTarget{WebSocketDebuggerURL: endpoint.Version(host)}); err != nil {
+			t.Error(err)
+		}
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if endpoint.Accept != nil {
+			if status := endpoint.Accept(r); status != 0 {
+				http.Error(w, http.StatusText(status), status)
+				return
+			}
+		}
+		c, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer c.Close()
+		for {
+			_, message, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			m := Message{}
+			if err := json.Unmarshal(message, &m); err != nil {
+				t.Error(err)
+				return
+			}
+			handler(c, m)
+		}
+	})
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	port, err := strconv.Atoi(u.Port())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return srv, port
+}
+
+// ServeCommands starts a devtools endpoint with a single page where each received command is passed to the given handler.
+func ServeCommands(t *testing.T, handler func(c *websocket.Conn, m Message)) (*httptest.Server, int) {
+	return ServeDevtools(t, TestEndpoint{}, handler)
+}
+
+// NewTestBrowser returns a browser value that logs nowhere and is connected to the given port.
+func NewTestBrowser(port int) *Browser {
+	return &Browser{
+		Port:    port,
+		Log:     log.New(ioutil.Discard, "", 0),
+		Console: log.New(ioutil.Discard, "", 0),
+	}
+}
+
+func TestConcurrentActions(t *testing.T) {
+	var mu sync.Mutex
+	srv, port := ServeCommands(t, func(c *websocket.Conn, m Message) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch m.Method {
+		case page.CommandPageNavigate:
+			// Reply right away but hold back the stopped loading event.
+			if err := c.WriteJSON(map[string]interface{}{"id": m.ID, "result": map[string]string{"frameId": "F1"}}); err != nil {
+				t.Error(err)
+			}
+		case page.CommandPageCaptureScreenshot:
+			if err := c.WriteJSON(map[string]interface{}{"id": m.ID, "result": map[string]string{"data": ""}}); err != nil {
+				t.Error(err)
+			}
+			if err := c.WriteJSON(map[string]interface{}{"method": page.EventPageFrameStoppedLoading, "params": map[string]string{"frameId": "F1"}}); err != nil {
+				t.Error(err)
+			}
+		}
+	})
+	defer srv.Close()
+
+	frame, err := Start(NewTestBrowser(port), LogBasic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer frame.Stop(false)
+
+	navigate := NewAction(
+		[]Event{
+			Event{Name: page.EventPageFrameStoppedLoading, Value: &page.FrameStoppedLoadingReply{}, IsRequired: true},
+		},
+		[]Command{
+			Command{ID: frame.RequestID.GetNext(), Method: page.CommandPageNavigate, Params: &page.NavigateArgs{URL: "http://localhost"}, Reply: &page.NavigateReply{}, Timeout: time.Second * 2},
+		})
+	done := make(chan error)
+	go func() {
+		done <- navigate.Run(frame)
+	}()
+
+	// Wait for the navigation reply so that the navigation is only waiting on its event.
+	for frame.GetFrameID() == "" {
+		time.Sleep(time.Millisecond)
+	}
+	screenshot := NewAction(
+		[]Event{},
+		[]Command{
+			Command{ID: frame.RequestID.GetNext(), Method: page.CommandPageCaptureScreenshot, Params: &page.CaptureScreenshotArgs{Format: "png"}, Reply: &page.CaptureScreenshotReply{}, Timeout: time.Second * 2},
+		})
+	if err := screenshot.Run(frame); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if !navigate.Events[page.EventPageFrameStoppedLoading].IsFound {
+		t.Fatal("Expecting the navigation to have found the stopped loading event.")
+	}
+	if len(frame.Actions) != 0 || len(frame.Pending) != 0 {
+		t.Fatalf("Expecting no active actions but found %d actions and %d pending commands", len(frame.Actions), len(frame.Pending))
+	}
+}
+
+func TestRunContextCancel(t *testing.T) {
+	var mu sync.Mutex
+	late := int64(0)
+	srv, port := ServeCommands(t, func(c *websocket.Conn, m Message) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if late == 0 {
+			// Hold the reply until the next command arrives.
+			late = m.ID
+			return
+		}
+		for _, id := range []int64{late, m.ID} {
+			if err := c.WriteJSON(map[string]interface{}{"id": id, "result": map[string]string{}}); err != nil {
+				t.Error(err)
+			}
+		}
+	})
+	defer srv.Close()
+
+	frame, err := Start(NewTestBrowser(port), LogBasic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer frame.Stop(false)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	err = NewAction(
+		[]Event{},
+		[]Command{
+			Command{ID: frame.RequestID.GetNext(), Method: page.CommandPageBringToFront, Params: &page.BringToFrontArgs{}, Reply: &page.BringToFrontReply{}, Timeout: time.Second * 2},
+		}).RunContext(ctx, frame)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("Expecting a deadline exceeded error but got %v", err)
+	}
+
+	// The late reply to the cancelled action must be discarded.
+	err = NewAction(
+		[]Event{},
+		[]Command{
+			Command{ID: frame.RequestID.GetNext(), Method: page.CommandPageBringToFront, Params: &page.BringToFrontArgs{}, Reply: &page.BringToFrontReply{}, Timeout: time.Second * 2},
+		}).Run(frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frame.Actions) != 0 || len(frame.Pending) != 0 {
+		t.Fatalf("Expecting no active actions but found %d actions and %d pending commands", len(frame.Actions), len(frame.Pending))
+	}
+}
+
+func TestConnectionClosed(t *testing.T) {
+	srv, port := ServeCommands(t, func(c *websocket.Conn, m Message) {
+		if err := c.Close(); err != nil {
+			t.Error(err)
+		}
+	})
+	defer srv.Close()
+
+	frame, err := Start(NewTestBrowser(port), LogBasic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer frame.Stop(false)
+
+	err = NewAction(
+		[]Event{},
+		[]Command{
+			Command{ID: frame.RequestID.GetNext(), Method: page.CommandPageBringToFront, Params: &page.BringToFrontArgs{}, Reply: &page.BringToFrontReply{}, Timeout: time.Second * 2},
+		}).Run(frame)
+	if !errors.Is(err, ErrConnectionClosed) {
+		t.Fatalf("Expecting a connection closed error but got %v", err)
+	}
+}
+
+func TestProtocolError(t *testing.T) {
+	var mu sync.Mutex
+	sent := 0
+	srv, port := ServeCommands(t, func(c *websocket.Conn, m Message) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		sent++
+		if err := c.WriteJSON(map[string]interface{}{"id": m.ID, "error": map[string]interface{}{"code": -32000, "message": "Could not find node with given id"}}); err != nil {
+			t.Error(err)
+		}
+	})
+	defer srv.Close()
+
+	frame, err := Start(NewTestBrowser(port), LogBasic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer frame.Stop(false)
+
+	start := time.Now()
+	err = NewAction(
+		[]Event{},
+		[]Command{
+			Command{ID: frame.RequestID.GetNext(), Method: page.CommandPageBringToFront, Params: &page.BringToFrontArgs{}, Reply: &page.BringToFrontReply{}, Timeout: time.Second * 2},
+		}).Run(frame)
+	e := &Error{}
+	if !errors.As(err, &e) {
+		t.Fatalf("Expecting a protocol error but got %v", err)
+	}
+	if e.Code != -32000 || e.Method != page.CommandPageBringToFront {
+		t.Fatalf("Unexpected protocol error %+v", e)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatal("Expecting the protocol error to be returned without waiting on the command timeout.")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if sent != 1 {
+		t.Fatalf("Expecting the command to be sent once but it was sent %d times", sent)
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	var mu sync.Mutex
+	sent := 0
+	srv, port := ServeCommands(t, func(c *websocket.Conn, m Message) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		sent++
+		reply := map[string]interface{}{"id": m.ID, "error": map[string]interface{}{"code": -32000, "message": "Not ready"}}
+		if sent == 3 {
+			reply = map[string]interface{}{"id": m.ID, "result": map[string]string{}}
+		}
+		if err := c.WriteJSON(reply); err != nil {
+			t.Error(err)
+		}
+	})
+	defer srv.Close()
+
+	frame, err := Start(NewTestBrowser(port), LogBasic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer frame.Stop(false)
+	frame.Retry = &RetryPolicy{Codes: []int64{-32000}, Attempts: 2, Backoff: time.Millisecond * 10}
+
+	err = NewAction(
+		[]Event{},
+		[]Command{
+			Command{ID: frame.RequestID.GetNext(), Method: page.CommandPageBringToFront, Params: &page.BringToFrontArgs{}, Reply: &page.BringToFrontReply{}, Timeout: time.Second * 2},
+		}).Run(frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The action's own policy takes precedence and does not retry this code.
+	act := NewAction(
+		[]Event{},
+		[]Command{
+			Command{ID: frame.RequestID.GetNext(), Method: page.CommandPageBringToFront, Params: &page.BringToFrontArgs{}, Reply: &page.BringToFrontReply{}, Timeout: time.Second * 2},
+		})
+	act.Retry = &RetryPolicy{Codes: []int64{-32601}, Attempts: 2, Backoff: time.Millisecond * 10}
+	e := &Error{}
+	if err := act.Run(frame); !errors.As(err, &e) {
+		t.Fatalf("Expecting a protocol error but got %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if sent != 4 {
+		t.Fatalf("Expecting the commands to be sent 4 times but they were sent %d times", sent)
+	}
+}
+
+// fakeTransport hands every command to send and blocks Receive until a reply is pushed or it is closed.
+type fakeTransport struct {
+	send    func(message []byte) error
+	replies chan []byte
+	closed  chan struct{}
+	once    sync.Once
+}
+
+func newFakeTransport(send func(message []byte) error) *fakeTransport {
+	return &fakeTransport{send: send, replies: make(chan []byte, 10), closed: make(chan struct{})}
+}
+
+func (t *fakeTransport) Send(message []byte) error {
+	return t.send(message)
+}
+
+func (t *fakeTransport) Receive() ([]byte, error) {
+	select {
+	case reply := <-t.replies:
+		return reply, nil
+	case <-t.closed:
+		return nil, errors.New("closed")
+	}
+}
+
+func (t *fakeTransport) Close() error {
+	t.once.Do(func() { close(t.closed) })
+	return nil
+}
+
+func TestClose(t *testing.T) {
+	bringToFront := func(frame *Frame) *Action {
+		return NewAction([]Event{}, []Command{
+			Command{ID: frame.RequestID.GetNext(), Method: page.CommandPageBringToFront, Params: &page.BringToFrontArgs{}, Reply: &page.BringToFrontReply{}, Timeout: time.Second * 5},
+		})
+	}
+	closed := func(done chan struct{}) bool {
+		select {
+		case <-done:
+			return true
+		default:
+			return false
+		}
+	}
+
+	// Pending actions fail as soon as the frame is closed and both loops are done when Close returns.
+	sent := make(chan struct{}, 1)
+	frame := StartWithTransport(NewTestBrowser(0), newFakeTransport(func(message []byte) error {
+		sent <- struct{}{}
+		return nil
+	}), LogBasic)
+	failed := make(chan error)
+	go func() {
+		failed <- bringToFront(frame).Run(frame)
+	}()
+	<-sent
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
+	defer cancel()
+	if err := frame.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-failed; !errors.Is(err, ErrConnectionClosed) {
+		t.Fatalf("Expecting a connection closed error but got %v", err)
+	}
+	if !closed(frame.readDone) || !closed(frame.writeDone) {
+		t.Fatal("Expecting the read and write loops to be done")
+	}
+	if err := frame.Close(ctx); err != nil {
+		t.Fatalf("Expecting a second close to succeed but got %v", err)
+	}
+	if err := frame.Stop(false); err != nil {
+		t.Fatalf("Expecting stop after close to succeed but got %v", err)
+	}
+	if err := bringToFront(frame).Run(frame); !errors.Is(err, ErrConnectionClosed) {
+		t.Fatalf("Expecting a connection closed error but got %v", err)
+	}
+
+	// The write loop has already returned on a failed send.
+	frame = StartWithTransport(NewTestBrowser(0), newFakeTransport(func(message []byte) error {
+		return errors.New("broken pipe")
+	}), LogBasic)
+	if err := bringToFront(frame).Run(frame); !errors.Is(err, ErrConnectionClosed) {
+		t.Fatalf("Expecting a connection closed error but got %v", err)
+	}
+	if err := frame.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// A send that never finishes holds up Close until its context is done.  A later Close finishes once the send does.
+	release := make(chan struct{})
+	frame = StartWithTransport(NewTestBrowser(0), newFakeTransport(func(message []byte) error {
+		sent <- struct{}{}
+		<-release
+		return nil
+	}), LogBasic)
+	go func() {
+		failed <- bringToFront(frame).Run(frame)
+	}()
+	<-sent
+	short, cancelShort := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancelShort()
+	if err := frame.Close(short); err != context.DeadlineExceeded {
+		t.Fatalf("Expecting the deadline to be exceeded but got %v", err)
+	}
+	if err := <-failed; !errors.Is(err, ErrConnectionClosed) {
+		t.Fatalf("Expecting a connection closed error but got %v", err)
+	}
+	close(release)
+	if err := frame.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
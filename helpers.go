@@ -8,22 +8,35 @@ import (
 
 // Message is the chrome DevTools Protocol message sent/read over the websocket connection.
 type Message struct {
-	ID     int64           `json:"id,omitempty"`     // Unique message identifier.
-	Method string          `json:"method,omitempty"` // Event or command type.
-	Params json.RawMessage `json:"params,omitempty"` // Event or command parameters.
-	Result json.RawMessage `json:"result,omitempty"` // Command return values.
-	Error  *Error          `json:"error,omitempty"`  // Error message.
+	ID        int64           `json:"id,omitempty"`        // Unique message identifier.
+	SessionID string          `json:"sessionId,omitempty"` // Session of the target that the message belongs to.
+	Method    string          `json:"method,omitempty"`    // Event or command type.
+	Params    json.RawMessage `json:"params,omitempty"`    // Event or command parameters.
+	Result    json.RawMessage `json:"result,omitempty"`    // Command return values.
+	Error     *Error          `json:"error,omitempty"`     // Error message.
 }
 
 // Error error type that is apart of the Message struct.
 type Error struct {
-	Code    int64  `json:"code"`    // Error code.
-	Message string `json:"message"` // Error message.
+	Code    int64  `json:"code"`           // Error code.
+	Message string `json:"message"`        // Error message.
+	Data    string `json:"data,omitempty"` // Additional error details.
+
+	Method string         `json:"-"` // Method of the command that failed.
+	Params json.Marshaler `json:"-"` // Params of the command that failed.
 }
 
 // Error satisfies the error interface.
 func (e *Error) Error() string {
-	return fmt.Sprintf("%s (%d)", e.Message, e.Code)
+	msg := fmt.Sprintf("%s (%d)", e.Message, e.Code)
+	if e.Data != "" {
+		msg = fmt.Sprintf("%s %s", msg, e.Data)
+	}
+	if e.Method != "" {
+		params, _ := json.Marshal(e.Params)
+		msg = fmt.Sprintf("%s: %s %s", msg, e.Method, params)
+	}
+	return msg
 }
 
 // RequestID stores the last value used for chrome devtool protocal requests being sent to the server.
@@ -0,0 +1,62 @@
+package cdp
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// MessageHistory is the number of the latest messages received by a frame that are kept for TimeoutError.
+// It applies to frames started after it is changed.  Zero keeps no messages.
+var MessageHistory = 20
+
+// history is a ring buffer of the latest raw messages received over a connection.
+type history struct {
+	mu       sync.Mutex
+	messages []json.RawMessage
+	next     int
+	full     bool
+}
+
+func newHistory(size int) *history {
+	return &history{messages: make([]json.RawMessage, size)}
+}
+
+// add keeps a copy of the message, replacing the oldest message once the buffer is full.
+func (h *history) add(message []byte) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.messages) == 0 {
+		return
+	}
+	h.messages[h.next] = append(json.RawMessage{}, message...)
+	h.next = (h.next + 1) % len(h.messages)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// last returns the kept messages from oldest to newest.
+func (h *history) last() []json.RawMessage {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !h.full {
+		return append([]json.RawMessage{}, h.messages[:h.next]...)
+	}
+	return append(append([]json.RawMessage{}, h.messages[h.next:]...), h.messages[:h.next]...)
+}
+
+// received returns the messages recently received over the frame's connection.  Sessions share the history of the frame that owns the connection.
+func (f *Frame) received() []json.RawMessage {
+	if f.parent != nil {
+		return f.parent.received()
+	}
+	if f.history == nil {
+		return nil
+	}
+	return f.history.last()
+}
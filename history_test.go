@@ -0,0 +1,26 @@
+package cdp
+
+import (
+	"testing"
+)
+
+func TestHistory(t *testing.T) {
+	h := newHistory(3)
+	if len(h.last()) != 0 {
+		t.Fatal("Expecting an empty history")
+	}
+	for _, m := range []string{"1", "2", "3", "4", "5"} {
+		h.add([]byte(m))
+	}
+	last := h.last()
+	if len(last) != 3 || string(last[0]) != "3" || string(last[1]) != "4" || string(last[2]) != "5" {
+		t.Fatalf("Expecting the latest three messages from oldest to newest but got %s", last)
+	}
+
+	// A history without room keeps nothing.
+	h = newHistory(0)
+	h.add([]byte("1"))
+	if len(h.last()) != 0 {
+		t.Fatal("Expecting no messages to be kept")
+	}
+}
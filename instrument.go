@@ -0,0 +1,122 @@
+package cdp
+
+import (
+	"time"
+)
+
+// CommandInfo describes a command at one point of its round trip to the browser.
+type CommandInfo struct {
+	ID        int64
+	Method    string
+	SessionID string
+	FrameID   string
+	Retry     int // The number of times the command has been sent again.
+
+	// Duration depends on the hook.  For CommandSent it is the time from handing the command to the write loop until the transport sent it.
+	// For ReplyReceived it is the time since the write loop began to send the command.  For Timeout it is the time since the command was handed to the frame.
+	Duration time.Duration
+
+	// Err is the protocol error that the browser replied with.
+	Err error
+}
+
+// EventInfo describes an event that was matched to a running action.
+type EventInfo struct {
+	Method        string
+	SessionID     string
+	FrameID       string
+	CommandMethod string        // The method of the action's current command.
+	Duration      time.Duration // The time since the action started.
+}
+
+// ActionInfo describes an action that has returned from Run.
+type ActionInfo struct {
+	Method   string // The method of the action's first command.
+	Commands int    // The number of commands that were completed.
+	Events   int    // The number of event occurrences that were matched.
+	Duration time.Duration
+	Err      error
+}
+
+// Instrumentation receives the timing of commands, events, and actions as a frame runs them.
+// The hooks are called synchronously by the frame, possibly while it holds its lock, so they must return quickly and must not use the frame.
+type Instrumentation interface {
+	CommandSent(info CommandInfo)
+	ReplyReceived(info CommandInfo)
+	EventMatched(info EventInfo)
+	ActionComplete(info ActionInfo)
+	Timeout(info CommandInfo)
+}
+
+// commandInfo returns the information about the given command of the action.  The frame's lock must be held.
+func (f *Frame) commandInfo(act *Action, c Command) CommandInfo {
+	return CommandInfo{
+		ID:        c.ID,
+		Method:    c.Method,
+		SessionID: f.SessionID,
+		FrameID:   f.FrameID,
+		Retry:     act.retries,
+	}
+}
+
+// commandWriting notes when the write loop begins to send the command so that the reply's latency leaves out the wait in the send queue.
+func (f *Frame) commandWriting(o outgoing) {
+	if f.Instrumentation == nil {
+		return
+	}
+	now := time.Now()
+	f.Lock()
+	o.act.written = now
+	o.act.writtenID = o.info.ID
+	f.Unlock()
+}
+
+// latency returns the time since the write loop began to send the command.  The frame's lock must be held.
+func (act *Action) latency(c Command) time.Duration {
+	if act.writtenID == c.ID && !act.written.IsZero() {
+		return time.Since(act.written)
+	}
+	return time.Since(act.sent)
+}
+
+// commandSent reports the command once the transport has sent it.
+func (f *Frame) commandSent(info CommandInfo, queued time.Time) {
+	if f.Instrumentation == nil {
+		return
+	}
+	info.Duration = time.Since(queued)
+	f.Instrumentation.CommandSent(info)
+}
+
+// commandTimedOut reports that the action's current command timed out.
+func (f *Frame) commandTimedOut(act *Action) {
+	if f.Instrumentation == nil {
+		return
+	}
+	f.RLock()
+	info := f.commandInfo(act, act.command())
+	info.Duration = time.Since(act.sent)
+	f.RUnlock()
+
+	f.Instrumentation.Timeout(info)
+}
+
+// actionComplete reports that the action returned from Run with the given error.
+func (f *Frame) actionComplete(act *Action, err error) {
+	if f.Instrumentation == nil {
+		return
+	}
+	f.RLock()
+	info := ActionInfo{
+		Method:   act.Commands[0].Method,
+		Commands: act.CommandIndex,
+		Duration: time.Since(act.started),
+		Err:      err,
+	}
+	for _, e := range act.Events {
+		info.Events += e.Found
+	}
+	f.RUnlock()
+
+	f.Instrumentation.ActionComplete(info)
+}
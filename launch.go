@@ -0,0 +1,141 @@
+package cdp
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// LaunchOptions describes how NewBrowserWithOptions starts the browser.
+// The zero value launches an auto-detected, headed browser on a free port with a fresh profile.
+type LaunchOptions struct {
+	Path    string // The browser's binary.  When empty, common Chrome and Chromium install locations are searched.
+	Port    int    // The devtools port.  When 0 the browser picks a free port.
+	LogFile string // Defaults to "browser.log" unless Logger is set, in which case no log file is created.
+
+	Headless     bool
+	WindowWidth  int // The window size is only set when both the width and height are given.
+	WindowHeight int
+	Proxy        string   // The proxy server, such as "http://localhost:3128" or "socks5://localhost:1080".
+	UserDataDir  string   // A profile directory to reuse.  Unlike the default temp directory it is not removed when the browser stops.
+	DisableGPU   bool     // Often needed when running headless on machines without a GPU.
+	NoSandbox    bool     // Usually required when running as root, such as within a container.
+	Env          []string // Extra "KEY=value" environment variables for the browser process.
+	Extensions   []string // Directories of unpacked extensions to load.
+
+	// Pipe drives the browser over --remote-debugging-pipe rather than a TCP port, so no debugging port is exposed on the host.
+	// Such a browser is started with StartBrowser.
+	Pipe bool
+
+	// Logger receives the browser's records and those of its frames.  When nil they are written to LogFile.
+	Logger Logger
+
+	// Flags are passed to the browser as they are.  A flag that sets the same switch as one of the fields above takes precedence over the field.
+	Flags []string
+}
+
+// BrowserPaths are the locations searched when LaunchOptions.Path is empty.  Bare names are looked up in PATH.
+var BrowserPaths = []string{
+	"google-chrome",
+	"google-chrome-stable",
+	"chromium",
+	"chromium-browser",
+	"/usr/bin/google-chrome",
+	"/usr/bin/google-chrome-stable",
+	"/opt/google/chrome/chrome",
+	"/usr/bin/chromium",
+	"/usr/bin/chromium-browser",
+	"/snap/bin/chromium",
+}
+
+// ErrBrowserNotFound is returned when no browser binary is found in any of the BrowserPaths.
+var ErrBrowserNotFound = errors.New("browser not found")
+
+// FindBrowser returns the first of the BrowserPaths that is an executable file.
+func FindBrowser() (string, error) {
+	for _, path := range BrowserPaths {
+		if found, err := exec.LookPath(path); err == nil {
+			return found, nil
+		}
+	}
+	return "", fmt.Errorf("%w in %s", ErrBrowserNotFound, strings.Join(BrowserPaths, ", "))
+}
+
+// args returns the flags for the options.  The user data dir and debugging port are left to the launcher.
+func (o LaunchOptions) args() []string {
+	args := []string{"--no-first-run", "--no-default-browser-check"}
+	if o.Headless {
+		args = append(args, "--headless")
+	}
+	if o.WindowWidth > 0 && o.WindowHeight > 0 {
+		args = append(args, fmt.Sprintf("--window-size=%d,%d", o.WindowWidth, o.WindowHeight))
+	}
+	if o.Proxy != "" {
+		args = append(args, "--proxy-server="+o.Proxy)
+	}
+	if o.DisableGPU {
+		args = append(args, "--disable-gpu")
+	}
+	if o.NoSandbox {
+		args = append(args, "--no-sandbox")
+	}
+	if len(o.Extensions) > 0 {
+		args = append(args, "--load-extension="+strings.Join(o.Extensions, ","))
+	}
+	return mergeFlags(args, o.Flags)
+}
+
+// mergeFlags appends the extra flags to the args keeping the order of both.
+// An extra flag replaces an arg for the same switch and repeated flags are only kept once.
+func mergeFlags(args []string, extra []string) []string {
+	merged := []string{}
+	seen := map[string]bool{}
+	overridden := map[string]bool{}
+	for _, flag := range extra {
+		overridden[flagName(flag)] = true
+	}
+	for _, flag := range args {
+		if overridden[flagName(flag)] || seen[flag] {
+			continue
+		}
+		seen[flag] = true
+		merged = append(merged, flag)
+	}
+	for _, flag := range extra {
+		if seen[flag] {
+			continue
+		}
+		seen[flag] = true
+		merged = append(merged, flag)
+	}
+	return merged
+}
+
+// flagName returns the switch of a flag without its value, such as "--window-size" for "--window-size=800,600".
+func flagName(flag string) string {
+	if at := strings.Index(flag, "="); at >= 0 {
+		return flag[:at]
+	}
+	return flag
+}
+
+// flagValue returns the value of the last flag for the switch in the flags.
+func flagValue(flags []string, name string) (string, bool) {
+	value, found := "", false
+	for _, flag := range flags {
+		if strings.HasPrefix(flag, name+"=") {
+			value, found = strings.TrimPrefix(flag, name+"="), true
+		}
+	}
+	return value, found
+}
+
+// environ returns the environment of the browser process.
+func (o LaunchOptions) environ() []string {
+	if len(o.Env) == 0 {
+		return nil
+	}
+	return append(os.Environ(), o.Env...)
+}
@@ -0,0 +1,100 @@
+package cdp
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLaunchOptionsArgs(t *testing.T) {
+	opts := LaunchOptions{
+		Headless:     true,
+		WindowWidth:  800,
+		WindowHeight: 600,
+		Proxy:        "socks5://localhost:1080",
+		DisableGPU:   true,
+		NoSandbox:    true,
+		Extensions:   []string{"/ext/a", "/ext/b"},
+		Flags:        []string{"--mute-audio", "--window-size=1024,768", "--no-first-run", "--mute-audio", "--lang=en"},
+	}
+	expected := []string{
+		"--no-default-browser-check",
+		"--headless",
+		"--proxy-server=socks5://localhost:1080",
+		"--disable-gpu",
+		"--no-sandbox",
+		"--load-extension=/ext/a,/ext/b",
+		"--mute-audio",
+		"--window-size=1024,768",
+		"--no-first-run",
+		"--lang=en",
+	}
+	if args := opts.args(); !reflect.DeepEqual(args, expected) {
+		t.Fatalf("Expecting %q but got %q", expected, args)
+	}
+}
+
+func TestNewBrowserWithOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cdp-fake-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The fake browser records its arguments and environment before announcing itself.
+	path := FakeBrowser(t, `echo "$@" > "$CDP_FAKE_OUT"
+echo "DevTools listening on ws://127.0.0.1:9/devtools/browser/abc" >&2
+exec sleep 10
+`)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	out := filepath.Join(dir, "args")
+	profile := filepath.Join(dir, "profile")
+	browser, err := NewBrowserWithOptions(LaunchOptions{
+		Path:        path,
+		Port:        9,
+		LogFile:     filepath.Join(dir, "browser.log"),
+		Headless:    true,
+		UserDataDir: profile,
+		Env:         []string{"CDP_FAKE_OUT=" + out},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := browser.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	args, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "--no-first-run --no-default-browser-check --headless --user-data-dir=" + profile + " --remote-debugging-port=9\n"
+	if string(args) != expected {
+		t.Fatalf("Expecting %q but got %q", expected, args)
+	}
+	if _, err := os.Stat(profile); err != nil {
+		t.Fatalf("Expecting the reused profile to remain after stopping but got %s", err)
+	}
+}
+
+func TestFindBrowser(t *testing.T) {
+	path := FakeBrowser(t, "exit 0\n")
+	defer os.RemoveAll(filepath.Dir(path))
+
+	paths := BrowserPaths
+	defer func() {
+		BrowserPaths = paths
+	}()
+
+	BrowserPaths = []string{filepath.Join(filepath.Dir(path), "missing"), path}
+	if found, err := FindBrowser(); err != nil || found != path {
+		t.Fatalf("Expecting %s but got %s %v", path, found, err)
+	}
+	BrowserPaths = BrowserPaths[:1]
+	if _, err := FindBrowser(); err == nil {
+		t.Fatal("Expecting an error when no browser is found.")
+	}
+}
@@ -0,0 +1,84 @@
+package cdp
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Field keys of the records written by frames and browsers.
+const (
+	FieldMethod    = "method"
+	FieldCommandID = "id"
+	FieldFrameID   = "frameId"
+	FieldSessionID = "sessionId"
+	FieldDuration  = "duration"
+	FieldDirection = "direction"
+	FieldError     = "error"
+	FieldMessage   = "message"
+	FieldState     = "state"
+)
+
+// Values of the FieldDirection field.
+const (
+	DirectionSend    = "send"
+	DirectionReceive = "receive"
+)
+
+// Field is a key and value attached to a log record.
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// Logger receives the log records of frames and browsers.
+// The level of each record is one of the LogLevelValue values, so a logger can map them onto its own levels.
+type Logger interface {
+	Log(level LogLevelValue, msg string, fields ...Field)
+}
+
+// LoggerFunc adapts a function to the Logger interface.
+type LoggerFunc func(level LogLevelValue, msg string, fields ...Field)
+
+// Log calls the function.
+func (fn LoggerFunc) Log(level LogLevelValue, msg string, fields ...Field) {
+	fn(level, msg, fields...)
+}
+
+// DiscardLogger drops every record.
+var DiscardLogger Logger = LoggerFunc(func(LogLevelValue, string, ...Field) {})
+
+// NewStdLogger returns a Logger that writes each record as one line of the given log.Logger with the fields as key=value pairs.
+func NewStdLogger(l *log.Logger) Logger {
+	return stdLogger{l: l}
+}
+
+type stdLogger struct {
+	l *log.Logger
+}
+
+func (s stdLogger) Log(level LogLevelValue, msg string, fields ...Field) {
+	b := strings.Builder{}
+	b.WriteString(level.String())
+	b.WriteString(" ")
+	b.WriteString(msg)
+	for _, field := range fields {
+		fmt.Fprintf(&b, " %s=%v", field.Key, field.Value)
+	}
+	s.l.Print(b.String())
+}
+
+// String returns the name of the level.
+func (l LogLevelValue) String() string {
+	switch l {
+	case LogError:
+		return "ERROR"
+	case LogBasic:
+		return "BASIC"
+	case LogDetails:
+		return "DETAILS"
+	case LogAll:
+		return "ALL"
+	}
+	return fmt.Sprintf("LEVEL(%d)", int(l))
+}
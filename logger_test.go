@@ -0,0 +1,134 @@
+package cdp
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/4ydx/cdp/protocol/page"
+	"github.com/gorilla/websocket"
+)
+
+func TestStdLogger(t *testing.T) {
+	b := &bytes.Buffer{}
+	NewStdLogger(log.New(b, "", 0)).Log(LogError, "action failed", Field{FieldMethod, "Page.navigate"}, Field{FieldCommandID, 11112})
+	if b.String() != "ERROR action failed method=Page.navigate id=11112\n" {
+		t.Fatalf("Unexpected record %q", b.String())
+	}
+}
+
+func TestFrameLogger(t *testing.T) {
+	srv, port := ServeCommands(t, func(c *websocket.Conn, m Message) {
+		if err := c.WriteJSON(map[string]interface{}{"id": m.ID, "result": map[string]string{}}); err != nil {
+			t.Error(err)
+		}
+	})
+	defer srv.Close()
+
+	type record struct {
+		level  LogLevelValue
+		msg    string
+		fields map[string]interface{}
+	}
+	var mu sync.Mutex
+	records := []record{}
+	browser := NewTestBrowser(port)
+	browser.Logger = LoggerFunc(func(level LogLevelValue, msg string, fields ...Field) {
+		r := record{level: level, msg: msg, fields: map[string]interface{}{}}
+		for _, field := range fields {
+			r.fields[field.Key] = field.Value
+		}
+		mu.Lock()
+		records = append(records, r)
+		mu.Unlock()
+	})
+
+	frame, err := Start(browser, LogBasic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer frame.Stop(false)
+
+	id := frame.RequestID.GetNext()
+	err = NewAction(
+		[]Event{},
+		[]Command{
+			Command{ID: id, Method: page.CommandPageBringToFront, Params: &page.BringToFrontArgs{}, Reply: &page.BringToFrontReply{}, Timeout: time.Second * 2},
+		}).Run(frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	sent, completed := false, false
+	for _, r := range records {
+		if r.level > LogBasic {
+			t.Fatalf("Expecting no records above the frame's log level but got %+v", r)
+		}
+		if r.msg == "message" && r.fields[FieldDirection] == DirectionSend {
+			sent = true
+		}
+		if r.msg == "command complete" {
+			completed = r.fields[FieldMethod] == page.CommandPageBringToFront && r.fields[FieldCommandID] == id
+			if _, ok := r.fields[FieldDuration].(time.Duration); !ok {
+				t.Fatalf("Expecting the duration of the command but got %+v", r)
+			}
+		}
+	}
+	if !sent || !completed {
+		t.Fatalf("Expecting records of the sent and completed command but got %+v", records)
+	}
+}
+
+func TestBrowserLogger(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cdp-fake-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	path := FakeBrowser(t, "echo 'DevTools listening on ws://127.0.0.1:9/devtools/browser/abc' >&2\nexec sleep 10\n")
+	defer os.RemoveAll(filepath.Dir(path))
+
+	var mu sync.Mutex
+	records := []string{}
+	browser, err := NewBrowserWithOptions(LaunchOptions{Path: path, Port: 9, Logger: LoggerFunc(func(level LogLevelValue, msg string, fields ...Field) {
+		mu.Lock()
+		records = append(records, msg)
+		mu.Unlock()
+	})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := browser.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The records go to the logger only, so no log file is created in the working directory.
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Fatalf("Expecting no log files but found %s", files[0].Name())
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(records) == 0 || records[0] != "launching the browser" {
+		t.Fatalf("Expecting the records to go to the logger but got %q", records)
+	}
+}
@@ -1,16 +1,16 @@
 package cdp
 
 import (
-	"log"
-	"os"
+	"errors"
 	"sync"
-	"time"
 )
 
 // LogLevelValue is the type for loglevel information.
 type LogLevelValue int
 
 const (
+	// LogError records failures.  Errors are recorded at every log level.
+	LogError = LogLevelValue(-1)
 	// LogBasic records outgoing commands, their replies, and any specified events.
 	LogBasic = LogLevelValue(0)
 	// LogDetails records additional details about the reply from the server for a given command/event.
@@ -19,40 +19,144 @@ const (
 	LogAll = LogLevelValue(2)
 )
 
-func init() {
-	file, err := os.Create("cdp.log")
-	if err != nil {
-		panic(err)
-	}
-	log.SetFlags(log.Llongfile | log.LstdFlags | log.Lmicroseconds)
-	log.SetOutput(file)
+// DefaultPort is the devtools port that Start connects to when no browser is given.
+var DefaultPort = 9222
+
+// StartOptions specifies the frame settings that its read and write loops use.  They are set before the loops start.
+type StartOptions struct {
+	LogLevel  LogLevelValue
+	Logger    Logger           // See Frame.Logger.
+	Reconnect *ReconnectPolicy // See Frame.Reconnect.
+	OnState   func(state ConnState, err error)
 }
 
 // Start prepares required resources to begin automation.
-func Start(browser *Browser, logLevel LogLevelValue) *Frame {
+func Start(browser *Browser, logLevel LogLevelValue) (*Frame, error) {
+	return StartWithOptions(browser, StartOptions{LogLevel: logLevel})
+}
+
+// StartWithOptions is Start with settings such as a ReconnectPolicy.
+func StartWithOptions(browser *Browser, opts StartOptions) (*Frame, error) {
 	// If browser is nil, the chrome protocal testing will still function as long as a browser is already
-	// properly open and listening for chrome devtools protocol requests on port 9222.
-	port := 9222
+	// properly open and listening for chrome devtools protocol requests on DefaultPort.
+	port := DefaultPort
 	if browser != nil {
 		port = browser.Port
 	}
-	frame := &Frame{
+	if browser != nil && browser.pipe != nil {
+		return nil, errors.New("a browser launched with a pipe must be started with StartBrowser")
+	}
+	ws, err := pageWebsocketURL(browser.logger(), port)
+	if err != nil {
+		return nil, err
+	}
+	// The page that was found is dialed again on reconnect, even when the browser has opened other pages since.
+	redial := func() (Transport, error) {
+		conn, err := dial(browser.logger(), ws)
+		if err != nil {
+			return nil, err
+		}
+		return NewWebsocketTransport(conn), nil
+	}
+	t, err := redial()
+	if err != nil {
+		return nil, err
+	}
+	return start(browser, t, redial, opts), nil
+}
+
+// StartBrowser connects to the browser target rather than a page target.
+// Pages are then created and attached to with the Target domain, with each attached page handled by its own session Frame.
+// A browser launched with LaunchOptions.Pipe is driven over its pipe.
+func StartBrowser(browser *Browser, logLevel LogLevelValue) (*Frame, error) {
+	return StartBrowserWithOptions(browser, StartOptions{LogLevel: logLevel})
+}
+
+// StartBrowserWithOptions is StartBrowser with settings such as a ReconnectPolicy.
+func StartBrowserWithOptions(browser *Browser, opts StartOptions) (*Frame, error) {
+	if browser.pipe != nil {
+		return start(browser, browser.pipe, nil, opts), nil
+	}
+	connect := func(ws string) (Transport, error) {
+		conn, err := dial(browser.logger(), ws)
+		if err != nil {
+			return nil, err
+		}
+		return NewWebsocketTransport(conn), nil
+	}
+	ws := browser.WebSocketURL
+	if ws == "" {
+		var err error
+		if ws, err = browserWebsocketURL(browser.logger(), browser.Port); err != nil {
+			return nil, err
+		}
+	}
+	t, err := connect(ws)
+	if err != nil {
+		return nil, err
+	}
+	// The browser target's url changes when the browser restarts, so it is looked up again whenever the port is known.
+	redial := func() (Transport, error) {
+		ws := browser.WebSocketURL
+		if browser.Port != 0 {
+			var err error
+			if ws, err = browserWebsocketURL(browser.logger(), browser.Port); err != nil {
+				return nil, err
+			}
+		}
+		return connect(ws)
+	}
+	return start(browser, t, redial, opts), nil
+}
+
+// StartWithTransport begins automation over an already established transport, such as a Replayer.
+func StartWithTransport(browser *Browser, t Transport, logLevel LogLevelValue) *Frame {
+	return StartWithTransportOptions(browser, t, StartOptions{LogLevel: logLevel})
+}
+
+// StartWithTransportOptions is StartWithTransport with settings such as a ReconnectPolicy, whose Dial then has to be set.
+func StartWithTransportOptions(browser *Browser, t Transport, opts StartOptions) *Frame {
+	return start(browser, t, nil, opts)
+}
+
+// start runs the loops of a new frame over the transport.  The dial function, when given, lets a ReconnectPolicy reach the same endpoint again.
+// The options are set before the loops start since the loops read them without the frame's lock.
+func start(browser *Browser, t Transport, dial func() (Transport, error), opts StartOptions) *Frame {
+	frame := newFrame(browser, opts.LogLevel)
+	frame.Transport = t
+	frame.dial = dial
+	frame.Logger = opts.Logger
+	frame.Reconnect = opts.Reconnect
+	frame.OnState = opts.OnState
+	frame.actionChan = make(chan outgoing, SendQueue)
+	frame.AllComplete = make(chan struct{})
+	frame.readDone = make(chan struct{})
+	frame.writeDone = make(chan struct{})
+	frame.history = newHistory(MessageHistory)
+	go Write(frame)
+	go Read(frame)
+	if frame.Browser != nil && frame.Browser.Done() != nil {
+		go frame.watchBrowser()
+	}
+
+	return frame
+}
+
+// SendQueue is the number of commands that a frame started after it is changed buffers for its write loop.
+var SendQueue = 256
+
+func newFrame(browser *Browser, logLevel LogLevelValue) *Frame {
+	return &Frame{
 		RWMutex: &sync.RWMutex{},
 		RequestID: RequestID{
 			RWMutex: &sync.RWMutex{},
 			Value:   11111,
 		},
-		Browser:           browser,
-		Conn:              GetWebsocket(browser.Log, port),
-		CurrentAction:     &Action{},
-		CacheCompleteChan: make(chan struct{}),
-		ActionChan:        make(chan []byte),
-		CommandChan:       make(chan (<-chan time.Time)),
-		AllComplete:       make(chan struct{}),
-		LogLevel:          logLevel,
+		Browser:       browser,
+		Pending:       make(map[int64]*Action),
+		Subscriptions: make(map[string][]*Subscription),
+		Sessions:      make(map[string]*Frame),
+		LogLevel:      logLevel,
+		QueueSize:     DefaultQueueSize,
 	}
-	go Write(frame)
-	go Read(frame)
-
-	return frame
 }
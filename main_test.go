@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"testing"
@@ -62,12 +63,21 @@ func Echo(w http.ResponseWriter, r *http.Request) {
 }
 
 func Serve() *http.Server {
-	srv := &http.Server{Addr: ":8080"}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/json", JSON)
+	mux.HandleFunc("/ws", Echo)
+	srv := &http.Server{Addr: ":8080", Handler: mux}
 
-	http.HandleFunc("/json", JSON)
-	http.HandleFunc("/ws", Echo)
+	// Listening before returning lets the caller connect right away.
+	l, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		log.Fatal(err)
+	}
 	go func() {
-		log.Fatal(srv.ListenAndServe())
+		// Shutdown makes Serve return ErrServerClosed, which is not a failure.
+		if err := srv.Serve(l); err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
 	}()
 	return srv
 }
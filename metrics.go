@@ -0,0 +1,214 @@
+package cdp
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultLatencyBounds are the upper bounds of the buckets that Metrics sorts latencies into.
+var DefaultLatencyBounds = []time.Duration{
+	time.Millisecond,
+	time.Millisecond * 5,
+	time.Millisecond * 10,
+	time.Millisecond * 25,
+	time.Millisecond * 50,
+	time.Millisecond * 100,
+	time.Millisecond * 250,
+	time.Millisecond * 500,
+	time.Second,
+	time.Second * 2,
+	time.Second * 5,
+	time.Second * 10,
+}
+
+// Histogram counts durations in buckets.  Counts[i] is the number of durations no greater than Bounds[i] and the last count holds the durations above every bound.
+type Histogram struct {
+	Bounds []time.Duration
+	Counts []int64
+	Count  int64
+	Sum    time.Duration
+	Min    time.Duration
+	Max    time.Duration
+}
+
+func newHistogram(bounds []time.Duration) Histogram {
+	return Histogram{Bounds: bounds, Counts: make([]int64, len(bounds)+1)}
+}
+
+func (h *Histogram) observe(d time.Duration) {
+	h.Counts[sort.Search(len(h.Bounds), func(i int) bool { return d <= h.Bounds[i] })]++
+	if h.Count == 0 || d < h.Min {
+		h.Min = d
+	}
+	if d > h.Max {
+		h.Max = d
+	}
+	h.Count++
+	h.Sum += d
+}
+
+func (h Histogram) copy() Histogram {
+	h.Counts = append([]int64{}, h.Counts...)
+	return h
+}
+
+// Mean returns the average duration.
+func (h Histogram) Mean() time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Sum / time.Duration(h.Count)
+}
+
+// Quantile returns the upper bound of the bucket that holds the q quantile, with 0 < q <= 1.
+// Durations above every bound are reported as Max.
+func (h Histogram) Quantile(q float64) time.Duration {
+	if h.Count == 0 {
+		return 0
+	}
+	rank := int64(q*float64(h.Count) + 0.5)
+	if rank < 1 {
+		rank = 1
+	}
+	var seen int64
+	for i, count := range h.Counts {
+		seen += count
+		if seen >= rank {
+			if i == len(h.Bounds) || h.Bounds[i] > h.Max {
+				return h.Max
+			}
+			return h.Bounds[i]
+		}
+	}
+	return h.Max
+}
+
+// MethodStats holds the counts and latencies of one protocol method.
+// Commands and events are counted under their own method while actions are counted under the method of their first command.
+type MethodStats struct {
+	Method   string
+	Sent     int64 // Includes retries.
+	Retries  int64
+	Replies  int64
+	Errors   int64 // Replies that were protocol errors.
+	Timeouts int64
+	Events   int64
+	Actions  int64
+	Failed   int64 // Actions that returned an error.
+
+	Queue         Histogram // Time that commands waited on the write loop.
+	Latency       Histogram // Time from the write loop sending a command until its reply.
+	ActionLatency Histogram // Time from starting an action until it returned.
+}
+
+// Metrics is an Instrumentation that keeps per-method counts and latency histograms in memory.
+type Metrics struct {
+	mu      sync.Mutex
+	bounds  []time.Duration
+	methods map[string]*MethodStats
+}
+
+// NewMetrics returns a collector that uses DefaultLatencyBounds.
+func NewMetrics() *Metrics {
+	return NewMetricsWithBounds(DefaultLatencyBounds)
+}
+
+// NewMetricsWithBounds returns a collector whose histograms use the given increasing bucket bounds.
+func NewMetricsWithBounds(bounds []time.Duration) *Metrics {
+	return &Metrics{bounds: append([]time.Duration{}, bounds...), methods: map[string]*MethodStats{}}
+}
+
+// stats returns the stats of the method.  The lock must be held.
+func (m *Metrics) stats(method string) *MethodStats {
+	s, ok := m.methods[method]
+	if !ok {
+		s = &MethodStats{
+			Method:        method,
+			Queue:         newHistogram(m.bounds),
+			Latency:       newHistogram(m.bounds),
+			ActionLatency: newHistogram(m.bounds),
+		}
+		m.methods[method] = s
+	}
+	return s
+}
+
+// CommandSent implements Instrumentation.
+func (m *Metrics) CommandSent(info CommandInfo) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := m.stats(info.Method)
+	s.Sent++
+	if info.Retry > 0 {
+		s.Retries++
+	}
+	s.Queue.observe(info.Duration)
+}
+
+// ReplyReceived implements Instrumentation.
+func (m *Metrics) ReplyReceived(info CommandInfo) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := m.stats(info.Method)
+	s.Replies++
+	if info.Err != nil {
+		s.Errors++
+	}
+	s.Latency.observe(info.Duration)
+}
+
+// EventMatched implements Instrumentation.
+func (m *Metrics) EventMatched(info EventInfo) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.stats(info.Method).Events++
+}
+
+// ActionComplete implements Instrumentation.
+func (m *Metrics) ActionComplete(info ActionInfo) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := m.stats(info.Method)
+	s.Actions++
+	if info.Err != nil {
+		s.Failed++
+	}
+	s.ActionLatency.observe(info.Duration)
+}
+
+// Timeout implements Instrumentation.
+func (m *Metrics) Timeout(info CommandInfo) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.stats(info.Method).Timeouts++
+}
+
+// Snapshot returns a copy of the stats keyed by method.
+func (m *Metrics) Snapshot() map[string]MethodStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snapshot := map[string]MethodStats{}
+	for method, s := range m.methods {
+		c := *s
+		c.Queue = s.Queue.copy()
+		c.Latency = s.Latency.copy()
+		c.ActionLatency = s.ActionLatency.copy()
+		snapshot[method] = c
+	}
+	return snapshot
+}
+
+// Reset discards every stat.
+func (m *Metrics) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.methods = map[string]*MethodStats{}
+}
@@ -0,0 +1,201 @@
+package cdp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/4ydx/cdp/protocol/dom"
+	"github.com/4ydx/cdp/protocol/page"
+	"github.com/gorilla/websocket"
+)
+
+func TestHistogram(t *testing.T) {
+	h := newHistogram([]time.Duration{time.Millisecond, time.Millisecond * 10, time.Millisecond * 100})
+	for _, d := range []time.Duration{time.Microsecond * 500, time.Millisecond * 2, time.Millisecond * 3, time.Millisecond * 50, time.Second} {
+		h.observe(d)
+	}
+	if h.Count != 5 || h.Min != time.Microsecond*500 || h.Max != time.Second {
+		t.Fatalf("Unexpected histogram %+v", h)
+	}
+	if h.Counts[0] != 1 || h.Counts[1] != 2 || h.Counts[2] != 1 || h.Counts[3] != 1 {
+		t.Fatalf("Unexpected bucket counts %v", h.Counts)
+	}
+	if q := h.Quantile(0.5); q != time.Millisecond*10 {
+		t.Fatalf("Expecting the median to fall in the 10ms bucket but got %s", q)
+	}
+	if q := h.Quantile(1); q != time.Second {
+		t.Fatalf("Expecting the largest duration to be reported as the max but got %s", q)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	srv, port := ServeCommands(t, func(c *websocket.Conn, m Message) {
+		var reply map[string]interface{}
+		switch m.Method {
+		case page.CommandPageNavigate:
+			reply = map[string]interface{}{"id": m.ID, "result": map[string]string{"frameId": "F1", "loaderId": "L1"}}
+		case dom.CommandDOMFocus:
+			reply = map[string]interface{}{"id": m.ID, "error": map[string]interface{}{"code": -32000, "message": "Could not find node with given id"}}
+		default:
+			// Never answered so that the command times out.
+			return
+		}
+		if err := c.WriteJSON(reply); err != nil {
+			t.Error(err)
+		}
+		if m.Method == page.CommandPageNavigate {
+			if err := c.WriteJSON(map[string]interface{}{"method": page.EventPageFrameStoppedLoading, "params": map[string]string{"frameId": "F1"}}); err != nil {
+				t.Error(err)
+			}
+		}
+	})
+	defer srv.Close()
+
+	frame, err := Start(NewTestBrowser(port), LogBasic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer frame.Stop(false)
+
+	metrics := NewMetrics()
+	frame.Instrumentation = metrics
+
+	for _, url := range []string{"http://localhost/a", "http://localhost/b"} {
+		if err := NavigateAction(frame, url).Run(frame); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = NewAction(
+		[]Event{},
+		[]Command{
+			Command{ID: frame.RequestID.GetNext(), Method: dom.CommandDOMFocus, Params: &dom.FocusArgs{NodeID: 1}, Reply: &dom.FocusReply{}, Timeout: time.Second * 2},
+		}).Run(frame)
+	if !errors.As(err, new(*Error)) {
+		t.Fatalf("Expecting a protocol error but got %v", err)
+	}
+	err = NewAction(
+		[]Event{},
+		[]Command{
+			Command{ID: frame.RequestID.GetNext(), Method: page.CommandPageBringToFront, Params: &page.BringToFrontArgs{}, Reply: &page.BringToFrontReply{}, Timeout: time.Millisecond * 100},
+		}).Run(frame)
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("Expecting a timeout but got %v", err)
+	}
+
+	stats := metrics.Snapshot()
+	navigate := stats[page.CommandPageNavigate]
+	if navigate.Sent != 2 || navigate.Replies != 2 || navigate.Errors != 0 || navigate.Actions != 2 || navigate.Failed != 0 {
+		t.Fatalf("Unexpected navigate stats %+v", navigate)
+	}
+	if navigate.Latency.Count != 2 || navigate.ActionLatency.Count != 2 || navigate.Queue.Count != 2 {
+		t.Fatalf("Expecting two latencies of each kind but got %+v", navigate)
+	}
+	if stats[page.EventPageFrameStoppedLoading].Events != 2 {
+		t.Fatalf("Expecting two matched events but got %+v", stats[page.EventPageFrameStoppedLoading])
+	}
+	focus := stats[dom.CommandDOMFocus]
+	if focus.Sent != 1 || focus.Replies != 1 || focus.Errors != 1 || focus.Failed != 1 {
+		t.Fatalf("Unexpected focus stats %+v", focus)
+	}
+	front := stats[page.CommandPageBringToFront]
+	if front.Sent != 1 || front.Replies != 0 || front.Timeouts != 1 || front.Failed != 1 {
+		t.Fatalf("Unexpected bring to front stats %+v", front)
+	}
+
+	metrics.Reset()
+	if len(metrics.Snapshot()) != 0 {
+		t.Fatal("Expecting no stats after a reset")
+	}
+}
+
+func TestMetricsQueue(t *testing.T) {
+	bringToFront := func(frame *Frame) *Action {
+		return NewAction([]Event{}, []Command{
+			Command{ID: frame.RequestID.GetNext(), Method: page.CommandPageBringToFront, Params: &page.BringToFrontArgs{}, Reply: &page.BringToFrontReply{}, Timeout: time.Millisecond * 500},
+		})
+	}
+
+	// The second command waits while the transport is busy with the first one.
+	metrics := NewMetrics()
+	frame := StartWithTransport(NewTestBrowser(0), newFakeTransport(func(message []byte) error {
+		time.Sleep(time.Millisecond * 100)
+		return nil
+	}), LogBasic)
+	defer frame.Stop(false)
+	frame.Instrumentation = metrics
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := bringToFront(frame).Run(frame); !errors.Is(err, ErrTimeout) {
+				t.Errorf("Expecting a timeout but got %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	front := metrics.Snapshot()[page.CommandPageBringToFront]
+	if front.Sent != 2 || front.Queue.Count != 2 || front.Queue.Max < time.Millisecond*200 {
+		t.Fatalf("Expecting the queue time to cover both sends but got %+v", front)
+	}
+
+	// A command that the transport fails to send is not counted as sent.
+	metrics = NewMetrics()
+	frame = StartWithTransport(NewTestBrowser(0), newFakeTransport(func(message []byte) error {
+		return errors.New("broken pipe")
+	}), LogBasic)
+	defer frame.Stop(false)
+	frame.Instrumentation = metrics
+	if err := bringToFront(frame).Run(frame); !errors.Is(err, ErrConnectionClosed) {
+		t.Fatalf("Expecting a connection closed error but got %v", err)
+	}
+	if front := metrics.Snapshot()[page.CommandPageBringToFront]; front.Sent != 0 {
+		t.Fatalf("Expecting no sent commands but got %+v", front)
+	}
+}
+
+func TestMetricsLatency(t *testing.T) {
+	// Each reply arrives at once but the transport stays busy afterwards so the second command waits in the queue.
+	// The latency only covers the time since the write loop began to send the command.
+	var transport *fakeTransport
+	transport = newFakeTransport(func(message []byte) error {
+		m := Message{}
+		if err := json.Unmarshal(message, &m); err != nil {
+			return err
+		}
+		transport.replies <- []byte(fmt.Sprintf(`{"id":%d,"result":{}}`, m.ID))
+		time.Sleep(time.Millisecond * 100)
+		return nil
+	})
+	metrics := NewMetrics()
+	frame := StartWithTransport(NewTestBrowser(0), transport, LogBasic)
+	defer frame.Stop(false)
+	frame.Instrumentation = metrics
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := NewAction([]Event{}, []Command{
+				Command{ID: frame.RequestID.GetNext(), Method: page.CommandPageBringToFront, Params: &page.BringToFrontArgs{}, Reply: &page.BringToFrontReply{}, Timeout: time.Second},
+			}).Run(frame)
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	front := metrics.Snapshot()[page.CommandPageBringToFront]
+	if front.Replies != 2 || front.Queue.Max < time.Millisecond*100 {
+		t.Fatalf("Expecting the second command to wait in the queue but got %+v", front)
+	}
+	if front.Latency.Count != 2 || front.Latency.Max >= time.Millisecond*50 {
+		t.Fatalf("Expecting the latency to leave out the queue time but got %+v", front.Latency)
+	}
+}
@@ -0,0 +1,316 @@
+package cdp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	shared "github.com/4ydx/cdp/protocol"
+	"github.com/4ydx/cdp/protocol/browser"
+	"github.com/4ydx/cdp/protocol/target"
+)
+
+// ErrPoolClosed is returned when acquiring a frame from a pool that has been closed.
+var ErrPoolClosed = errors.New("pool closed")
+
+// PoolOptions describes the browsers of a BrowserPool.
+type PoolOptions struct {
+	Size     int           // The number of browsers.  Defaults to 1.
+	MaxUses  int           // The number of times a browser is handed out before it is replaced by a new one.  0 means no limit.
+	Timeout  time.Duration // The timeout of each command sent while checking, preparing, and resetting browsers.  Defaults to 10 seconds.
+	LogLevel LogLevelValue
+
+	// Launch describes each browser.  The port is always chosen by the browser and each browser logs to its own
+	// numbered copy of the log file, such as "browser.log.1".
+	Launch LaunchOptions
+}
+
+// BrowserPool keeps browsers running so that frames can be handed out without paying for a browser launch each time.
+// Every acquired frame is a page in its own browser context, so cookies, storage, and cache are not shared with earlier uses.
+type BrowserPool struct {
+	opts PoolOptions
+
+	// idle holds one entry for each browser that is not in use.  A nil entry is a browser that still needs to be launched.
+	idle chan *pooledBrowser
+
+	// done is closed by Close so that calls to Acquire waiting on an idle browser return.
+	done chan struct{}
+
+	mu       sync.Mutex
+	leased   map[*Frame]*pooledBrowser
+	running  map[*pooledBrowser]bool
+	launched int
+	closed   bool
+}
+
+// pooledBrowser is a browser of the pool along with the frame connected to its browser target.
+type pooledBrowser struct {
+	browser   *Browser
+	frame     *Frame
+	uses      int
+	contextID shared.ContextID
+	session   *Frame
+}
+
+// NewBrowserPool launches the pool's browsers and waits until every one of them is ready.
+func NewBrowserPool(opts PoolOptions) (*BrowserPool, error) {
+	if opts.Size <= 0 {
+		opts.Size = 1
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = time.Second * 10
+	}
+	if opts.Launch.LogFile == "" && opts.Launch.Logger == nil {
+		opts.Launch.LogFile = "browser.log"
+	}
+	opts.Launch.Port = 0
+	opts.Launch.UserDataDir = ""
+
+	p := &BrowserPool{
+		opts:    opts,
+		idle:    make(chan *pooledBrowser, opts.Size),
+		done:    make(chan struct{}),
+		leased:  map[*Frame]*pooledBrowser{},
+		running: map[*pooledBrowser]bool{},
+	}
+	for i := 0; i < opts.Size; i++ {
+		pb, err := p.launch()
+		if err != nil {
+			p.Close()
+			return nil, err
+		}
+		p.idle <- pb
+	}
+	return p, nil
+}
+
+// Acquire waits for an idle browser and returns a frame for a new page in a fresh browser context of that browser.
+// A browser that fails its health check is replaced before it is used.  The frame must be handed back with Release.
+func (p *BrowserPool) Acquire(ctx context.Context) (*Frame, error) {
+	var pb *pooledBrowser
+	select {
+	case pb = <-p.idle:
+	case <-p.done:
+		return nil, ErrPoolClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if p.isClosed() {
+		p.idle <- pb
+		return nil, ErrPoolClosed
+	}
+
+	if pb != nil && !p.healthy(ctx, pb) {
+		if err := ctx.Err(); err != nil {
+			p.idle <- pb
+			return nil, err
+		}
+		pb.frame.LogAt(LogBasic, "replacing unhealthy browser")
+		p.stop(pb)
+		pb = nil
+	}
+	if pb == nil {
+		var err error
+		if pb, err = p.launch(); err != nil {
+			p.idle <- nil
+			return nil, err
+		}
+	}
+
+	session, err := p.prepare(ctx, pb)
+	if err != nil {
+		p.stop(pb)
+		p.idle <- nil
+		return nil, err
+	}
+	pb.uses++
+
+	p.mu.Lock()
+	p.leased[session] = pb
+	p.mu.Unlock()
+
+	return session, nil
+}
+
+// Release disposes of the frame's browser context, closing its page and clearing its data, and returns the browser to the pool.
+// A browser that has reached MaxUses, or could not be reset, is stopped and a new one is launched in its place.
+func (p *BrowserPool) Release(frame *Frame) error {
+	p.mu.Lock()
+	pb, ok := p.leased[frame]
+	delete(p.leased, frame)
+	closed := p.closed
+	p.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("frame %s was not acquired from the pool", frame.SessionID)
+	}
+	if closed {
+		return nil
+	}
+
+	err := p.reset(pb)
+	if err != nil || (p.opts.MaxUses > 0 && pb.uses >= p.opts.MaxUses) {
+		pb.frame.LogAt(LogBasic, fmt.Sprintf("recycling browser after %d uses", pb.uses))
+		p.stop(pb)
+		go p.replace()
+		return err
+	}
+	p.idle <- pb
+	return nil
+}
+
+// Close stops every browser of the pool, including those whose frames have not been released.
+// Calls to Acquire that are waiting on a browser return ErrPoolClosed.
+func (p *BrowserPool) Close() error {
+	p.mu.Lock()
+	if !p.closed {
+		close(p.done)
+	}
+	p.closed = true
+	running := []*pooledBrowser{}
+	for pb := range p.running {
+		running = append(running, pb)
+	}
+	p.mu.Unlock()
+
+	var err error
+	for _, pb := range running {
+		if e := p.stop(pb); err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+func (p *BrowserPool) isClosed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.closed
+}
+
+// launch starts a browser and connects to its browser target.
+func (p *BrowserPool) launch() (*pooledBrowser, error) {
+	p.mu.Lock()
+	p.launched++
+	opts := p.opts.Launch
+	if opts.LogFile != "" {
+		opts.LogFile = fmt.Sprintf("%s.%d", opts.LogFile, p.launched)
+	}
+	p.mu.Unlock()
+
+	b, err := NewBrowserWithOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	frame, err := StartBrowser(b, p.opts.LogLevel)
+	if err != nil {
+		if e := b.Stop(); e != nil {
+			b.logger().Log(LogError, e.Error())
+		}
+		return nil, err
+	}
+	pb := &pooledBrowser{browser: b, frame: frame}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		go p.stop(pb)
+		return nil, ErrPoolClosed
+	}
+	p.running[pb] = true
+	return pb, nil
+}
+
+// replace launches a browser in place of one that was stopped.  On failure an empty entry is left for Acquire to fill.
+func (p *BrowserPool) replace() {
+	pb, err := p.launch()
+	if err != nil {
+		pb = nil
+	}
+	p.idle <- pb
+}
+
+// stop stops the browser and removes it from the pool.
+func (p *BrowserPool) stop(pb *pooledBrowser) error {
+	p.mu.Lock()
+	running := p.running[pb]
+	delete(p.running, pb)
+	p.mu.Unlock()
+
+	if !running {
+		return nil
+	}
+	return pb.frame.Stop(true)
+}
+
+// healthy indicates that the browser is still running and answering commands.
+func (p *BrowserPool) healthy(ctx context.Context, pb *pooledBrowser) bool {
+	select {
+	case <-pb.browser.Done():
+		return false
+	default:
+	}
+	err := NewAction(
+		[]Event{},
+		[]Command{
+			Command{ID: pb.frame.RequestID.GetNext(), Method: browser.CommandBrowserGetVersion, Params: &browser.GetVersionArgs{}, Reply: &browser.GetVersionReply{}, Timeout: p.opts.Timeout},
+		}).RunContext(ctx, pb.frame)
+	if err != nil {
+		pb.frame.LogError(fmt.Errorf("health check: %w", err))
+		return false
+	}
+	return true
+}
+
+// prepare creates a browser context with a blank page and attaches to the page.
+func (p *BrowserPool) prepare(ctx context.Context, pb *pooledBrowser) (*Frame, error) {
+	frame := pb.frame
+	createContext := &target.CreateBrowserContextReply{}
+	err := NewAction(
+		[]Event{},
+		[]Command{
+			Command{ID: frame.RequestID.GetNext(), Method: target.CommandTargetCreateBrowserContext, Params: &target.CreateBrowserContextArgs{}, Reply: createContext, Timeout: p.opts.Timeout},
+		}).RunContext(ctx, frame)
+	if err != nil {
+		return nil, err
+	}
+	pb.contextID = createContext.BrowserContextID
+
+	createTarget := &target.CreateTargetReply{}
+	attach := &target.AttachToTargetReply{}
+	err = NewAction(
+		[]Event{},
+		[]Command{
+			Command{ID: frame.RequestID.GetNext(), Method: target.CommandTargetCreateTarget, Params: &target.CreateTargetArgs{URL: "about:blank", BrowserContextID: pb.contextID}, Reply: createTarget, Timeout: p.opts.Timeout},
+		}).RunContext(ctx, frame)
+	if err != nil {
+		return nil, err
+	}
+	err = NewAction(
+		[]Event{},
+		[]Command{
+			Command{ID: frame.RequestID.GetNext(), Method: target.CommandTargetAttachToTarget, Params: &target.AttachToTargetArgs{TargetID: createTarget.TargetID, Flatten: true}, Reply: attach, Timeout: p.opts.Timeout},
+		}).RunContext(ctx, frame)
+	if err != nil {
+		return nil, err
+	}
+	pb.session = frame.NewSession(string(createTarget.TargetID), string(attach.SessionID))
+	return pb.session, nil
+}
+
+// reset disposes of the browser context of the last use, which closes its pages and discards its data.
+func (p *BrowserPool) reset(pb *pooledBrowser) error {
+	frame := pb.frame
+	if pb.session != nil {
+		frame.RemoveSession(pb.session.SessionID)
+		pb.session = nil
+	}
+	return NewAction(
+		[]Event{},
+		[]Command{
+			Command{ID: frame.RequestID.GetNext(), Method: target.CommandTargetDisposeBrowserContext, Params: &target.DisposeBrowserContextArgs{BrowserContextID: pb.contextID}, Reply: &target.DisposeBrowserContextReply{}, Timeout: p.opts.Timeout},
+		}).Run(frame)
+}
@@ -0,0 +1,143 @@
+package cdp
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/4ydx/cdp/protocol/browser"
+	"github.com/4ydx/cdp/protocol/target"
+	"github.com/gorilla/websocket"
+)
+
+func TestBrowserPool(t *testing.T) {
+	timeout := StopTimeout
+	StopTimeout = time.Millisecond * 100
+	defer func() {
+		StopTimeout = timeout
+	}()
+
+	var mu sync.Mutex
+	commands := map[string]int{}
+	srv, port := ServeCommands(t, func(c *websocket.Conn, m Message) {
+		mu.Lock()
+		commands[m.Method]++
+		count := commands[m.Method]
+		mu.Unlock()
+
+		result := map[string]interface{}{}
+		switch m.Method {
+		case browser.CommandBrowserClose:
+			return
+		case target.CommandTargetCreateBrowserContext:
+			result["browserContextId"] = fmt.Sprintf("C%d", count)
+		case target.CommandTargetCreateTarget:
+			result["targetId"] = fmt.Sprintf("T%d", count)
+		case target.CommandTargetAttachToTarget:
+			result["sessionId"] = fmt.Sprintf("S%d", count)
+		}
+		if err := c.WriteJSON(map[string]interface{}{"id": m.ID, "result": result}); err != nil {
+			t.Error(err)
+		}
+	})
+	defer srv.Close()
+
+	path := FakeBrowser(t, fmt.Sprintf("trap 'exit 0' TERM\necho 'DevTools listening on ws://127.0.0.1:%d/ws' >&2\nwhile :; do sleep 0.01; done\n", port))
+	dir := filepath.Dir(path)
+	defer os.RemoveAll(dir)
+
+	pool, err := NewBrowserPool(PoolOptions{
+		Size:    2,
+		MaxUses: 2,
+		Launch:  LaunchOptions{Path: path, LogFile: filepath.Join(dir, "browser.log")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	ctx := context.Background()
+	first, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.SessionID == "" || first.SessionID == second.SessionID {
+		t.Fatalf("Expecting separate sessions but got %q and %q", first.SessionID, second.SessionID)
+	}
+
+	// Both browsers are in use.
+	short, cancel := context.WithTimeout(ctx, time.Millisecond*50)
+	defer cancel()
+	if _, err := pool.Acquire(short); err != context.DeadlineExceeded {
+		t.Fatalf("Expecting the deadline to pass but got %v", err)
+	}
+
+	if err := pool.Release(first); err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.Release(first); err == nil {
+		t.Fatal("Expecting an error when releasing a frame twice.")
+	}
+	third, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The browser of the first and third frames has reached its maximum uses and is replaced.
+	if err := pool.Release(third); err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.Release(second); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		f, err := pool.Acquire(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer pool.Release(f)
+	}
+
+	pool.mu.Lock()
+	launched := pool.launched
+	pool.mu.Unlock()
+	if launched != 3 {
+		t.Fatalf("Expecting 3 browsers to be launched but got %d", launched)
+	}
+
+	// Closing the pool while every browser is in use releases a waiting Acquire.
+	waiting := make(chan error)
+	go func() {
+		_, err := pool.Acquire(ctx)
+		waiting <- err
+	}()
+	time.Sleep(time.Millisecond * 20)
+	if err := pool.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-waiting:
+		if err != ErrPoolClosed {
+			t.Fatalf("Expecting the pool to be closed but got %v", err)
+		}
+	case <-time.After(time.Second * 2):
+		t.Fatal("Expecting Acquire to return once the pool is closed")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if commands[target.CommandTargetDisposeBrowserContext] != 3 {
+		t.Fatalf("Expecting each released frame's browser context to be disposed but got %v", commands)
+	}
+	if commands[browser.CommandBrowserGetVersion] != 5 {
+		t.Fatalf("Expecting a health check for each acquired frame but got %v", commands)
+	}
+}
@@ -0,0 +1,275 @@
+package cdp
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/4ydx/cdp/protocol/target"
+)
+
+// ConnState is the state of the connection of a frame.
+type ConnState int32
+
+const (
+	// ConnConnected is the state of a frame whose connection is up.
+	ConnConnected ConnState = iota
+	// ConnReconnecting is the state of a frame whose connection dropped while its ReconnectPolicy is redialing.
+	ConnReconnecting
+	// ConnClosed is the state of a frame whose connection was closed or could not be recovered.
+	ConnClosed
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case ConnConnected:
+		return "connected"
+	case ConnReconnecting:
+		return "reconnecting"
+	case ConnClosed:
+		return "closed"
+	}
+	return fmt.Sprintf("ConnState(%d)", int32(s))
+}
+
+// ReconnectPolicy specifies how a frame recovers from a dropped connection.
+// The connection is redialed, every session is attached to its target again, and the domains that were enabled are enabled again.
+// Actions that were running when the connection dropped fail with ErrConnectionReset.
+type ReconnectPolicy struct {
+	Attempts   int           // Maximum number of times that the connection is dialed after it drops.
+	Backoff    time.Duration // Wait before the first dial.  Each later dial waits twice as long as the one before it.
+	MaxBackoff time.Duration // Longest wait between dials when set.
+	Timeout    time.Duration // Limits each command sent to recover the sessions and enabled domains.  Defaults to ten seconds.
+
+	// Dial returns a new connection.  When nil the page that Start found is dialed again, and StartBrowser looks up the browser target again.
+	Dial func() (Transport, error)
+}
+
+// delay returns the wait before the dial that follows the given number of failed dials.
+func (p *ReconnectPolicy) delay(attempt int) time.Duration {
+	d := p.Backoff << uint(attempt)
+	if p.MaxBackoff > 0 && (d > p.MaxBackoff || d < p.Backoff) {
+		d = p.MaxBackoff
+	}
+	return d
+}
+
+func (p *ReconnectPolicy) timeout() time.Duration {
+	if p.Timeout > 0 {
+		return p.Timeout
+	}
+	return time.Second * 10
+}
+
+// root returns the frame that owns the connection.
+func (f *Frame) root() *Frame {
+	if f.parent != nil {
+		return f.parent
+	}
+	return f
+}
+
+// State returns the state of the frame's connection.  Sessions report the state of the connection that they share.
+func (f *Frame) State() ConnState {
+	return ConnState(atomic.LoadInt32(&f.root().state))
+}
+
+// setState changes the state of the connection and calls OnState when the state is different.
+func (f *Frame) setState(state ConnState, err error) {
+	if ConnState(atomic.SwapInt32(&f.state, int32(state))) == state {
+		return
+	}
+	fields := []Field{Field{FieldState, state}}
+	if err != nil {
+		fields = append(fields, Field{FieldError, err})
+	}
+	f.log(LogBasic, "connection state", fields...)
+	if f.OnState != nil {
+		f.OnState(state, err)
+	}
+}
+
+// stateError returns the error for a command that cannot be sent in the current state of the connection.
+func (f *Frame) stateError() error {
+	switch f.State() {
+	case ConnReconnecting:
+		return fmt.Errorf("%w: reconnecting", ErrConnectionReset)
+	case ConnClosed:
+		return ErrConnectionClosed
+	}
+	return nil
+}
+
+// transport returns the current connection of the frame.
+func (f *Frame) transport() Transport {
+	root := f.root()
+	root.RLock()
+	defer root.RUnlock()
+
+	return root.Transport
+}
+
+// reconnect dials a new connection after the read loop lost the previous one.
+// It returns false when the frame has no ReconnectPolicy, the frame is being closed, or every dial failed.
+func (f *Frame) reconnect(cause error) bool {
+	p := f.Reconnect
+	if p == nil {
+		return false
+	}
+	dial := p.Dial
+	if dial == nil {
+		dial = f.dial
+	}
+	if dial == nil {
+		return false
+	}
+	generation := atomic.AddInt64(&f.generation, 1)
+	f.setState(ConnReconnecting, cause)
+	f.failAll(fmt.Errorf("%w: %s", ErrConnectionReset, cause))
+	if err := f.transport().Close(); err != nil {
+		f.log(LogDetails, "close: "+err.Error())
+	}
+
+	for attempt := 0; attempt < p.Attempts; attempt++ {
+		select {
+		case <-time.After(p.delay(attempt)):
+		case <-f.AllComplete:
+			return false
+		}
+		t, err := dial()
+		if err != nil {
+			f.log(LogError, fmt.Sprintf("reconnect %d: %s", attempt+1, err))
+			continue
+		}
+
+		// Close reads the transport after AllComplete is closed, so a new transport is either closed here or by Close.
+		f.Lock()
+		if f.closing() {
+			f.Unlock()
+			t.Close()
+			return false
+		}
+		f.Transport = t
+		f.Unlock()
+		f.reset()
+		for _, session := range f.GetSessions() {
+			session.Lock()
+			session.Transport = t
+			session.Unlock()
+			session.reset()
+		}
+		f.log(LogBasic, fmt.Sprintf("reconnected after %d attempts", attempt+1))
+
+		// Recovery needs the read loop for its replies so it runs on its own goroutine.
+		go f.recover(generation)
+		return true
+	}
+	return false
+}
+
+// reset forgets the frame and document of the dropped connection, which may belong to a browser that was restarted.
+func (f *Frame) reset() {
+	f.Lock()
+	defer f.Unlock()
+
+	f.FrameID = ""
+	f.LoaderID = ""
+	f.DOM = nil
+}
+
+// recover attaches every session to its target again and enables the domains that were enabled before the connection dropped.
+// A session that cannot be attached again is removed.  The connection is reported as connected with the first error of the recovery, if any.
+func (f *Frame) recover(generation int64) {
+	timeout := f.Reconnect.timeout()
+	var err error
+	for _, session := range f.GetSessions() {
+		if e := f.reattach(session, timeout); e != nil {
+			f.log(LogError, "reattach: "+e.Error(), Field{FieldSessionID, session.SessionID})
+			f.RemoveSession(session.SessionID)
+			if err == nil {
+				err = e
+			}
+		}
+	}
+	for _, frame := range append([]*Frame{f}, f.GetSessions()...) {
+		if e := frame.replayEnabled(timeout); e != nil {
+			f.log(LogError, "enable: "+e.Error(), Field{FieldSessionID, frame.SessionID})
+			if err == nil {
+				err = e
+			}
+		}
+	}
+	if atomic.LoadInt64(&f.generation) == generation && !f.closing() {
+		f.setState(ConnConnected, err)
+	}
+}
+
+// reattach attaches the session to its target over the new connection and routes messages with the new session id to it.
+func (f *Frame) reattach(session *Frame, timeout time.Duration) error {
+	act := NewAction(
+		[]Event{},
+		[]Command{
+			Command{ID: f.RequestID.GetNext(), Method: target.CommandTargetAttachToTarget, Params: &target.AttachToTargetArgs{TargetID: target.ID(session.TargetID), Flatten: true}, Reply: &target.AttachToTargetReply{}, Timeout: timeout},
+		})
+	if err := f.run(act); err != nil {
+		return err
+	}
+	sessionID := string(act.Commands[0].Reply.(*target.AttachToTargetReply).SessionID)
+
+	f.Lock()
+	delete(f.Sessions, session.SessionID)
+	f.Sessions[sessionID] = session
+	f.Unlock()
+
+	session.Lock()
+	session.SessionID = sessionID
+	session.logSessionID.Store(sessionID)
+	session.Unlock()
+	return nil
+}
+
+// replayEnabled sends the enable commands that completed before the connection dropped once more, in the order they were first sent.
+func (f *Frame) replayEnabled(timeout time.Duration) error {
+	f.RLock()
+	commands := []Command{}
+	for _, c := range f.enabled {
+		commands = append(commands, Command{
+			ID:      f.RequestID.GetNext(),
+			Method:  c.Method,
+			Params:  c.Params,
+			Reply:   reflect.New(reflect.TypeOf(c.Reply).Elem()).Interface().(CommandReply),
+			Timeout: timeout,
+		})
+	}
+	f.RUnlock()
+
+	if len(commands) == 0 {
+		return nil
+	}
+	return f.run(NewAction([]Event{}, commands))
+}
+
+// run sends the action directly, since recovery happens while State still reports ConnReconnecting.
+func (f *Frame) run(act *Action) error {
+	act.recovery = true
+	return act.Run(f)
+}
+
+// remember keeps the completed command when it enables a domain so that it can be replayed after a reconnect.  A command that disables a domain forgets its enable command.
+func (f *Frame) remember(c Command) {
+	if !strings.HasSuffix(c.Method, ".enable") && !strings.HasSuffix(c.Method, ".disable") {
+		return
+	}
+	domain := c.Method[:strings.LastIndex(c.Method, ".")]
+	for i, e := range f.enabled {
+		if strings.HasPrefix(e.Method, domain+".") {
+			f.enabled = append(f.enabled[:i], f.enabled[i+1:]...)
+			break
+		}
+	}
+	if strings.HasSuffix(c.Method, ".enable") && c.Reply != nil {
+		f.enabled = append(f.enabled, Command{Method: c.Method, Params: c.Params, Reply: c.Reply})
+	}
+}
@@ -0,0 +1,249 @@
+package cdp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/4ydx/cdp/protocol/dom"
+	"github.com/4ydx/cdp/protocol/network"
+	"github.com/4ydx/cdp/protocol/page"
+	"github.com/4ydx/cdp/protocol/target"
+	"github.com/gorilla/websocket"
+)
+
+func TestReconnect(t *testing.T) {
+	var mu sync.Mutex
+	conns := []*websocket.Conn{}
+	received := map[int][]string{}
+	srv, port := ServeCommands(t, func(c *websocket.Conn, m Message) {
+		mu.Lock()
+		if len(conns) == 0 || conns[len(conns)-1] != c {
+			conns = append(conns, c)
+		}
+		n := len(conns)
+		received[n] = append(received[n], m.SessionID+" "+m.Method+" "+string(m.Params))
+		mu.Unlock()
+
+		switch m.Method {
+		case page.CommandPageStopLoading:
+			// Drops the connection.
+			if err := c.Close(); err != nil {
+				t.Error(err)
+			}
+			return
+		case target.CommandTargetAttachToTarget:
+			if err := c.WriteJSON(map[string]interface{}{"id": m.ID, "result": map[string]string{"sessionId": fmt.Sprintf("S%d", n)}}); err != nil {
+				t.Error(err)
+			}
+			return
+		}
+		if err := c.WriteJSON(map[string]interface{}{"id": m.ID, "sessionId": m.SessionID, "result": map[string]string{}}); err != nil {
+			t.Error(err)
+		}
+	})
+	defer srv.Close()
+
+	// The dial is refused once the test is done with the first reconnect.
+	var refuse int32
+	states := make(chan ConnState, 10)
+	frame, err := StartBrowserWithOptions(NewTestBrowser(port), StartOptions{
+		LogLevel: LogBasic,
+		Reconnect: &ReconnectPolicy{Attempts: 3, Backoff: time.Millisecond * 10, Timeout: time.Second, Dial: func() (Transport, error) {
+			if atomic.LoadInt32(&refuse) == 1 {
+				return nil, errors.New("refused")
+			}
+			conn, err := GetBrowserWebsocket(DiscardLogger, port)
+			if err != nil {
+				return nil, err
+			}
+			return NewWebsocketTransport(conn), nil
+		}},
+		OnState: func(state ConnState, err error) {
+			states <- state
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer frame.Stop(false)
+
+	run := func(f *Frame, method string, params json.Marshaler, reply CommandReply) error {
+		return NewAction([]Event{}, []Command{
+			Command{ID: f.RequestID.GetNext(), Method: method, Params: params, Reply: reply, Timeout: time.Second},
+		}).Run(f)
+	}
+	session := frame.NewSession("T1", "S0")
+	if err := run(frame, dom.CommandDOMEnable, &dom.EnableArgs{}, &dom.EnableReply{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := run(frame, network.CommandNetworkEnable, &network.EnableArgs{}, &network.EnableReply{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := run(frame, network.CommandNetworkDisable, &network.DisableArgs{}, &network.DisableReply{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := run(session, page.CommandPageEnable, &page.EnableArgs{}, &page.EnableReply{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := run(frame, page.CommandPageStopLoading, &page.StopLoadingArgs{}, &page.StopLoadingReply{}); !errors.Is(err, ErrConnectionReset) {
+		t.Fatalf("Expecting a connection reset error but got %v", err)
+	}
+	for _, want := range []ConnState{ConnReconnecting, ConnConnected} {
+		select {
+		case state := <-states:
+			if state != want {
+				t.Fatalf("Expecting state %s but got %s", want, state)
+			}
+		case <-time.After(time.Second * 2):
+			t.Fatalf("Expecting state %s", want)
+		}
+	}
+
+	// The session is attached again and only the domains that are still enabled are enabled again.
+	if session.SessionID != "S2" || frame.GetSession("S2") != session || frame.GetSession("S0") != nil {
+		t.Fatalf("Expecting the session to be attached as S2 but got %s", session.SessionID)
+	}
+	mu.Lock()
+	replayed := received[2]
+	mu.Unlock()
+	if len(replayed) != 3 ||
+		!strings.HasPrefix(replayed[0], " "+target.CommandTargetAttachToTarget) || !strings.Contains(replayed[0], `"targetId":"T1"`) ||
+		!strings.HasPrefix(replayed[1], " "+dom.CommandDOMEnable) ||
+		!strings.HasPrefix(replayed[2], "S2 "+page.CommandPageEnable) {
+		t.Fatalf("Unexpected recovery commands %q", replayed)
+	}
+	if err := run(session, page.CommandPageBringToFront, &page.BringToFrontArgs{}, &page.BringToFrontReply{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Once every dial fails the frame is closed.
+	atomic.StoreInt32(&refuse, 1)
+	if err := run(frame, page.CommandPageStopLoading, &page.StopLoadingArgs{}, &page.StopLoadingReply{}); !errors.Is(err, ErrConnectionReset) {
+		t.Fatalf("Expecting a connection reset error but got %v", err)
+	}
+	for _, want := range []ConnState{ConnReconnecting, ConnClosed} {
+		select {
+		case state := <-states:
+			if state != want {
+				t.Fatalf("Expecting state %s but got %s", want, state)
+			}
+		case <-time.After(time.Second * 2):
+			t.Fatalf("Expecting state %s", want)
+		}
+	}
+	if err := run(frame, page.CommandPageBringToFront, &page.BringToFrontArgs{}, &page.BringToFrontReply{}); !errors.Is(err, ErrConnectionClosed) {
+		t.Fatalf("Expecting a connection closed error but got %v", err)
+	}
+}
+
+// ServeRestarts starts a devtools endpoint whose browser target gets a new url with each connection, as when the browser restarts.
+// The page targets keep their urls but are listed in reverse order after the first connection.  Page.stopLoading drops the connection.
+// The returned function reports the paths of the websocket connections.
+func ServeRestarts(t *testing.T) (*httptest.Server, int, func() []string) {
+	var mu sync.Mutex
+	paths := []string{}
+	srv, port := ServeDevtools(t, TestEndpoint{
+		Targets: func(host string) []DiscoveredTarget {
+			targets := []DiscoveredTarget{DiscoveredTarget{WebSocketDebuggerURL: "ws://" + host + "/devtools/page/A"}, DiscoveredTarget{WebSocketDebuggerURL: "ws://" + host + "/devtools/page/B"}}
+			mu.Lock()
+			if len(paths) > 0 {
+				targets[0], targets[1] = targets[1], targets[0]
+			}
+			mu.Unlock()
+			return targets
+		},
+		Version: func(host string) string {
+			mu.Lock()
+			defer mu.Unlock()
+			return fmt.Sprintf("ws://%s/devtools/browser/G%d", host, len(paths))
+		},
+		Accept: func(r *http.Request) int {
+			mu.Lock()
+			defer mu.Unlock()
+			if strings.HasPrefix(r.URL.Path, "/devtools/browser/") && r.URL.Path != fmt.Sprintf("/devtools/browser/G%d", len(paths)) {
+				return http.StatusNotFound
+			}
+			paths = append(paths, r.URL.Path)
+			return 0
+		},
+	}, func(c *websocket.Conn, m Message) {
+		if m.Method == page.CommandPageStopLoading {
+			c.Close()
+			return
+		}
+		if err := c.WriteJSON(map[string]interface{}{"id": m.ID, "result": map[string]string{}}); err != nil {
+			t.Error(err)
+		}
+	})
+	return srv, port, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string{}, paths...)
+	}
+}
+
+func TestReconnectEndpoint(t *testing.T) {
+	run := func(f *Frame, method string, params json.Marshaler, reply CommandReply) error {
+		return NewAction([]Event{}, []Command{
+			Command{ID: f.RequestID.GetNext(), Method: method, Params: params, Reply: reply, Timeout: time.Second},
+		}).Run(f)
+	}
+	tests := []struct {
+		start func(port int, opts StartOptions) (*Frame, error)
+		want  []string
+	}{
+		// A page frame dials the same page again although another page is now listed last.
+		{func(port int, opts StartOptions) (*Frame, error) { return StartWithOptions(NewTestBrowser(port), opts) }, []string{"/devtools/page/B", "/devtools/page/B"}},
+		// A browser frame looks up the new url of the browser target instead of dialing the one that the browser announced at launch.
+		{func(port int, opts StartOptions) (*Frame, error) {
+			browser := NewTestBrowser(port)
+			browser.WebSocketURL = fmt.Sprintf("ws://localhost:%d/devtools/browser/G0", port)
+			return StartBrowserWithOptions(browser, opts)
+		}, []string{"/devtools/browser/G0", "/devtools/browser/G1"}},
+	}
+	for _, test := range tests {
+		srv, port, paths := ServeRestarts(t)
+		states := make(chan ConnState, 10)
+		frame, err := test.start(port, StartOptions{
+			LogLevel:  LogBasic,
+			Reconnect: &ReconnectPolicy{Attempts: 3, Backoff: time.Millisecond * 10, Timeout: time.Second},
+			OnState: func(state ConnState, err error) {
+				states <- state
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := run(frame, page.CommandPageStopLoading, &page.StopLoadingArgs{}, &page.StopLoadingReply{}); !errors.Is(err, ErrConnectionReset) {
+			t.Fatalf("Expecting a connection reset error but got %v", err)
+		}
+		for _, want := range []ConnState{ConnReconnecting, ConnConnected} {
+			select {
+			case state := <-states:
+				if state != want {
+					t.Fatalf("Expecting state %s but got %s", want, state)
+				}
+			case <-time.After(time.Second * 2):
+				t.Fatalf("Expecting state %s", want)
+			}
+		}
+		if err := run(frame, page.CommandPageBringToFront, &page.BringToFrontArgs{}, &page.BringToFrontReply{}); err != nil {
+			t.Fatal(err)
+		}
+		frame.Stop(false)
+		srv.Close()
+		if got := paths(); strings.Join(got, " ") != strings.Join(test.want, " ") {
+			t.Fatalf("Expecting connections to %q but got %q", test.want, got)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package cdp
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// TranscriptEntry is one line of a recorded transcript.
+type TranscriptEntry struct {
+	Time      time.Time       `json:"time"`
+	Direction string          `json:"direction"` // DirectionSend or DirectionReceive.
+	Message   json.RawMessage `json:"message"`
+}
+
+// Recorder writes every message that a frame sends and receives to a JSONL transcript.
+// Command ids are renumbered from 1 in the order that the commands are sent, so transcripts do not depend on the frame's RequestID.
+type Recorder struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	ids map[int64]int64
+	err error
+}
+
+// NewRecorder returns a recorder that writes the transcript to w.
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{enc: json.NewEncoder(w), ids: map[int64]int64{}}
+}
+
+// Record writes the message to the transcript.  Once a write fails every later call returns the same error.
+func (r *Recorder) Record(direction string, message []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err != nil {
+		return r.err
+	}
+	message, r.err = mapID(message, func(id int64) int64 {
+		normal, ok := r.ids[id]
+		if !ok && direction == DirectionSend {
+			normal = int64(len(r.ids) + 1)
+			r.ids[id] = normal
+		}
+		if !ok && direction == DirectionReceive {
+			// A reply to a command that was not recorded keeps its id.
+			return id
+		}
+		return normal
+	})
+	if r.err != nil {
+		return r.err
+	}
+	r.err = r.enc.Encode(TranscriptEntry{Time: time.Now(), Direction: direction, Message: message})
+	return r.err
+}
+
+// Err returns the first error encountered while recording.
+func (r *Recorder) Err() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.err
+}
+
+// Record writes every message that the frame sends and receives from now on to the recorder.
+// A nil recorder stops recording.  Sessions are recorded by the frame that owns the connection.
+func (f *Frame) Record(r *Recorder) {
+	if f.parent != nil {
+		f.parent.Record(r)
+		return
+	}
+	f.Lock()
+	defer f.Unlock()
+
+	f.recorder = r
+}
+
+func (f *Frame) record(direction string, message []byte) {
+	f.RLock()
+	r := f.recorder
+	f.RUnlock()
+
+	if r == nil {
+		return
+	}
+	if err := r.Record(direction, message); err != nil {
+		f.log(LogError, "record: "+err.Error())
+	}
+}
+
+// mapID rewrites the top level id of the message.  Messages without an id, such as events, are returned as they are.
+func mapID(message []byte, fn func(id int64) int64) ([]byte, error) {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(message, &fields); err != nil {
+		return nil, err
+	}
+	raw, ok := fields["id"]
+	if !ok {
+		return message, nil
+	}
+	var id int64
+	if err := json.Unmarshal(raw, &id); err != nil {
+		return nil, err
+	}
+	mapped := fn(id)
+	if mapped == id {
+		return message, nil
+	}
+	b, err := json.Marshal(mapped)
+	if err != nil {
+		return nil, err
+	}
+	fields["id"] = b
+	return json.Marshal(fields)
+}
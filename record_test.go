@@ -0,0 +1,101 @@
+package cdp
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/4ydx/cdp/protocol/page"
+	"github.com/gorilla/websocket"
+)
+
+// NavigateAction returns an action that navigates to the url and waits for the frame to stop loading.
+func NavigateAction(frame *Frame, url string) *Action {
+	return NewAction(
+		[]Event{
+			Event{Name: page.EventPageFrameStoppedLoading, Value: &page.FrameStoppedLoadingReply{}, IsRequired: true},
+		},
+		[]Command{
+			Command{ID: frame.RequestID.GetNext(), Method: page.CommandPageNavigate, Params: &page.NavigateArgs{URL: url}, Reply: &page.NavigateReply{}, Timeout: time.Second * 2},
+		})
+}
+
+func TestRecordReplay(t *testing.T) {
+	srv, port := ServeCommands(t, func(c *websocket.Conn, m Message) {
+		if err := c.WriteJSON(map[string]interface{}{"id": m.ID, "result": map[string]string{"frameId": "F1", "loaderId": "L1"}}); err != nil {
+			t.Error(err)
+		}
+		if err := c.WriteJSON(map[string]interface{}{"method": page.EventPageFrameStoppedLoading, "params": map[string]string{"frameId": "F1"}}); err != nil {
+			t.Error(err)
+		}
+	})
+	defer srv.Close()
+
+	frame, err := Start(NewTestBrowser(port), LogBasic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transcript := &bytes.Buffer{}
+	recorder := NewRecorder(transcript)
+	frame.Record(recorder)
+	for _, url := range []string{"http://localhost/a", "http://localhost/b"} {
+		if err := NavigateAction(frame, url).Run(frame); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := frame.Stop(false); err != nil {
+		t.Fatal(err)
+	}
+	if err := recorder.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Command ids are renumbered in the transcript.
+	entries := []TranscriptEntry{}
+	dec := json.NewDecoder(bytes.NewReader(transcript.Bytes()))
+	for dec.More() {
+		entry := TranscriptEntry{}
+		if err := dec.Decode(&entry); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) != 6 || entries[0].Direction != DirectionSend || entries[1].Direction != DirectionReceive {
+		t.Fatalf("Unexpected transcript %s", transcript)
+	}
+	m := Message{}
+	if err := json.Unmarshal(entries[3].Message, &m); err != nil || m.ID != 2 {
+		t.Fatalf("Expecting the second command to be recorded with id 2 but got %s", entries[3].Message)
+	}
+
+	// The replayed frame starts from a different request id.
+	replayer, err := NewReplayer(bytes.NewReader(transcript.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer replayer.Close()
+	replayed := StartWithTransport(NewTestBrowser(0), replayer, LogBasic)
+	replayed.RequestID.Value = 50000
+	for _, url := range []string{"http://localhost/a", "http://localhost/b"} {
+		act := NavigateAction(replayed, url)
+		if err := act.Run(replayed); err != nil {
+			t.Fatal(err)
+		}
+		if reply := act.Commands[0].Reply.(*page.NavigateReply); reply.FrameID != "F1" {
+			t.Fatalf("Expecting the recorded reply but got %+v", reply)
+		}
+	}
+	if replayer.Remaining() != 0 {
+		t.Fatalf("Expecting every recorded command to be sent but %d remain", replayer.Remaining())
+	}
+
+	// A command that was not recorded fails the action.
+	if err := NavigateAction(replayed, "http://localhost/c").Run(replayed); !errors.Is(err, ErrConnectionClosed) {
+		t.Fatalf("Expecting the unrecorded command to fail but got %v", err)
+	}
+	if !errors.Is(replayer.Err(), ErrReplayMismatch) {
+		t.Fatalf("Expecting a replay mismatch but got %v", replayer.Err())
+	}
+}
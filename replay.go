@@ -0,0 +1,172 @@
+package cdp
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+)
+
+// ErrReplayMismatch is returned when a frame sends a command that the transcript being replayed does not contain.
+var ErrReplayMismatch = errors.New("command not in transcript")
+
+// Replayer is a Transport that plays back a transcript written by a Recorder so that actions can run without a browser.
+// Each command that the frame sends must match a recorded command with the same method, session, and params.
+// The received messages of the transcript are handed to the frame once every command recorded before them has been sent.
+// Recorded command ids are mapped to the ids of the commands that the frame actually sends.
+type Replayer struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	entries []TranscriptEntry
+	matched []bool // matched marks the send entries that have been matched and the receive entries that have been read.
+	ids     map[int64]int64
+	closed  bool
+	err     error
+}
+
+// NewReplayer reads the transcript from r.
+func NewReplayer(r io.Reader) (*Replayer, error) {
+	rp := &Replayer{ids: map[int64]int64{}}
+	rp.cond = sync.NewCond(&rp.mu)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		entry := TranscriptEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, err
+		}
+		if entry.Direction != DirectionSend && entry.Direction != DirectionReceive {
+			return nil, fmt.Errorf("unknown transcript direction %q", entry.Direction)
+		}
+		rp.entries = append(rp.entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	rp.matched = make([]bool, len(rp.entries))
+	return rp, nil
+}
+
+// Receive returns the next received message of the transcript.
+// It blocks while commands recorded before the message have not been sent and returns an error once the replayer is closed.
+func (rp *Replayer) Receive() ([]byte, error) {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	for {
+		if rp.closed {
+			return nil, io.EOF
+		}
+		if i := rp.next(); i >= 0 {
+			rp.matched[i] = true
+			return mapID(rp.entries[i].Message, func(id int64) int64 {
+				if live, ok := rp.ids[id]; ok {
+					return live
+				}
+				return id
+			})
+		}
+		rp.cond.Wait()
+	}
+}
+
+// next returns the index of the first unread received message that can be read or -1.
+func (rp *Replayer) next() int {
+	for i, entry := range rp.entries {
+		if rp.matched[i] {
+			continue
+		}
+		if entry.Direction == DirectionSend {
+			return -1
+		}
+		return i
+	}
+	return -1
+}
+
+// Send matches the command against the unsent commands of the transcript.
+func (rp *Replayer) Send(data []byte) error {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	if rp.closed {
+		return io.ErrClosedPipe
+	}
+	sent := struct {
+		ID int64 `json:"id"`
+	}{}
+	if err := json.Unmarshal(data, &sent); err != nil {
+		return err
+	}
+	for i, entry := range rp.entries {
+		if rp.matched[i] || entry.Direction != DirectionSend {
+			continue
+		}
+		if !sameCommand(entry.Message, data) {
+			continue
+		}
+		recorded := sent
+		if err := json.Unmarshal(entry.Message, &recorded); err != nil {
+			return err
+		}
+		rp.matched[i] = true
+		rp.ids[recorded.ID] = sent.ID
+		rp.cond.Broadcast()
+		return nil
+	}
+	rp.err = fmt.Errorf("%w: %s", ErrReplayMismatch, data)
+	return rp.err
+}
+
+// Close stops the replay.  Blocked reads return an error.
+func (rp *Replayer) Close() error {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	rp.closed = true
+	rp.cond.Broadcast()
+	return nil
+}
+
+// Err returns the mismatch, if any, that ended the replay.
+func (rp *Replayer) Err() error {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	return rp.err
+}
+
+// Remaining returns the number of recorded commands that have not been sent.
+func (rp *Replayer) Remaining() int {
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	count := 0
+	for i, entry := range rp.entries {
+		if !rp.matched[i] && entry.Direction == DirectionSend {
+			count++
+		}
+	}
+	return count
+}
+
+// sameCommand compares two encoded commands while ignoring their ids.
+func sameCommand(a, b []byte) bool {
+	var ca, cb map[string]interface{}
+	if err := json.Unmarshal(a, &ca); err != nil {
+		return false
+	}
+	if err := json.Unmarshal(b, &cb); err != nil {
+		return false
+	}
+	delete(ca, "id")
+	delete(cb, "id")
+	return reflect.DeepEqual(ca, cb)
+}
@@ -0,0 +1,31 @@
+package cdp
+
+import (
+	"time"
+)
+
+// RetryPolicy specifies which protocol errors cause a command to be sent to the server again.
+// Commands are never retried unless a policy is set on the Frame or the Action.
+type RetryPolicy struct {
+	Codes    []int64       // Protocol error codes that are retried.
+	Attempts int           // Maximum number of times that a single command is sent again.
+	Backoff  time.Duration // Wait before the first retry.  Each later retry waits twice as long as the one before it.
+}
+
+// allows indicates that a command that has been retried the given number of times can be retried after receiving the error code.
+func (p *RetryPolicy) allows(code int64, retries int) bool {
+	if p == nil || retries >= p.Attempts {
+		return false
+	}
+	for _, c := range p.Codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// delay returns the backoff before the next retry of a command that has been retried the given number of times.
+func (p *RetryPolicy) delay(retries int) time.Duration {
+	return p.Backoff << uint(retries)
+}
@@ -0,0 +1,69 @@
+package cdp
+
+import (
+	"fmt"
+)
+
+// NewSession returns a Frame for the target that was attached to with the given session id.
+// The session shares the websocket connection of the frame and all of its commands are sent with the session id.
+func (f *Frame) NewSession(targetID, sessionID string) *Frame {
+	session := newFrame(f.Browser, f.LogLevel)
+	session.Transport = f.Transport
+	session.actionChan = f.actionChan
+	session.writeDone = f.writeDone
+	session.QueueSize = f.QueueSize
+	session.SlowConsumer = f.SlowConsumer
+	session.AllComplete = f.AllComplete
+	session.Retry = f.Retry
+	session.Logger = f.Logger
+	session.Instrumentation = f.Instrumentation
+	session.TargetID = targetID
+	session.SessionID = sessionID
+	session.logSessionID.Store(sessionID)
+	session.parent = f
+
+	f.Lock()
+	f.Sessions[sessionID] = session
+	f.Unlock()
+
+	return session
+}
+
+// GetSession returns the session Frame with the given session id or nil when there is no such session.
+func (f *Frame) GetSession(sessionID string) *Frame {
+	f.RLock()
+	defer f.RUnlock()
+
+	return f.Sessions[sessionID]
+}
+
+// GetSessions returns all of the session Frames that are currently attached.
+func (f *Frame) GetSessions() []*Frame {
+	f.RLock()
+	defer f.RUnlock()
+
+	sessions := []*Frame{}
+	for _, s := range f.Sessions {
+		sessions = append(sessions, s)
+	}
+	return sessions
+}
+
+// RemoveSession stops routing messages to the session with the given id.
+// Any actions that the session is still running fail since their replies will never arrive.
+func (f *Frame) RemoveSession(sessionID string) {
+	f.Lock()
+	session, ok := f.Sessions[sessionID]
+	delete(f.Sessions, sessionID)
+	f.Unlock()
+
+	if ok {
+		session.removeSubscriptions()
+		session.FailActions(fmt.Errorf("%w: session %s detached", ErrConnectionClosed, sessionID))
+	}
+}
+
+// IsSession indicates that the frame is attached to a target through another frame's connection.
+func (f *Frame) IsSession() bool {
+	return f.parent != nil
+}
@@ -0,0 +1,107 @@
+package cdp
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/4ydx/cdp/protocol/page"
+	"github.com/4ydx/cdp/protocol/target"
+	"github.com/gorilla/websocket"
+)
+
+func TestSessions(t *testing.T) {
+	var mu sync.Mutex
+	sessions := []string{}
+	srv, port := ServeCommands(t, func(c *websocket.Conn, m Message) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		sessions = append(sessions, m.SessionID)
+		switch m.Method {
+		case page.CommandPageNavigate:
+			// The same event is sent for both sessions but only S1 is navigating.
+			for _, id := range []string{"S2", "S1"} {
+				if err := c.WriteJSON(map[string]interface{}{"sessionId": id, "method": page.EventPageFrameStoppedLoading, "params": map[string]string{"frameId": "F" + id}}); err != nil {
+					t.Error(err)
+				}
+			}
+			if err := c.WriteJSON(map[string]interface{}{"sessionId": m.SessionID, "id": m.ID, "result": map[string]string{"frameId": "F" + m.SessionID}}); err != nil {
+				t.Error(err)
+			}
+		case target.CommandTargetCloseTarget:
+			if err := c.WriteJSON(map[string]interface{}{"method": target.EventTargetDetachedFromTarget, "params": map[string]string{"sessionId": "S2"}}); err != nil {
+				t.Error(err)
+			}
+			if err := c.WriteJSON(map[string]interface{}{"id": m.ID, "result": map[string]bool{"success": true}}); err != nil {
+				t.Error(err)
+			}
+		}
+	})
+	defer srv.Close()
+
+	frame, err := StartBrowser(NewTestBrowser(port), LogBasic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer frame.Stop(false)
+
+	s1 := frame.NewSession("T1", "S1")
+	s2 := frame.NewSession("T2", "S2")
+
+	// The event sent for S2 must not complete the navigation of S1.
+	navigate := NewAction(
+		[]Event{
+			Event{Name: page.EventPageFrameStoppedLoading, Value: &page.FrameStoppedLoadingReply{}, IsRequired: true},
+		},
+		[]Command{
+			Command{ID: s1.RequestID.GetNext(), Method: page.CommandPageNavigate, Params: &page.NavigateArgs{URL: "http://localhost"}, Reply: &page.NavigateReply{}, Timeout: time.Second * 2},
+		})
+	if err := navigate.Run(s1); err != nil {
+		t.Fatal(err)
+	}
+	if s1.GetFrameID() != "FS1" || s2.GetFrameID() != "" {
+		t.Fatalf("Expecting only the S1 frame id to be set but got %q and %q", s1.GetFrameID(), s2.GetFrameID())
+	}
+
+	// Closing the S2 target detaches its session, which fails any action that is still running on it.
+	waiting := NewAction(
+		[]Event{},
+		[]Command{
+			Command{ID: s2.RequestID.GetNext(), Method: page.CommandPageBringToFront, Params: &page.BringToFrontArgs{}, Reply: &page.BringToFrontReply{}, Timeout: time.Second * 2},
+		})
+	done := make(chan error)
+	go func() {
+		done <- waiting.Run(s2)
+	}()
+	for {
+		s2.RLock()
+		count := len(s2.Actions)
+		s2.RUnlock()
+		if count == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	err = NewAction(
+		[]Event{},
+		[]Command{
+			Command{ID: frame.RequestID.GetNext(), Method: target.CommandTargetCloseTarget, Params: &target.CloseTargetArgs{TargetID: "T2"}, Reply: &target.CloseTargetReply{}, Timeout: time.Second * 2},
+		}).Run(frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; !errors.Is(err, ErrConnectionClosed) {
+		t.Fatalf("Expecting a closed connection error for the detached session but got %v", err)
+	}
+	if frame.GetSession("S2") != nil || frame.GetSession("S1") != s1 {
+		t.Fatal("Expecting only the S2 session to be removed.")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(sessions) != 3 || sessions[0] != "S1" || sessions[1] != "S2" || sessions[2] != "" {
+		t.Fatalf("Unexpected command sessions %q", sessions)
+	}
+}
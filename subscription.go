@@ -0,0 +1,235 @@
+package cdp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/4ydx/cdp/protocol/lib"
+)
+
+// EventHandler receives the decoded value of an event that a frame has subscribed to.
+type EventHandler func(value json.Unmarshaler)
+
+// RawEvent holds the params of an event that the generated protocol code does not know how to decode.
+type RawEvent json.RawMessage
+
+// UnmarshalJSON stores a copy of the given bytes.
+func (r *RawEvent) UnmarshalJSON(b []byte) error {
+	*r = append((*r)[0:0], b...)
+	return nil
+}
+
+// DefaultQueueSize is the number of unhandled events that each subscription of a new frame may queue.
+var DefaultQueueSize = 1024
+
+// SlowConsumerPolicy decides what happens to an event that arrives while a subscription's queue is full.
+type SlowConsumerPolicy int
+
+const (
+	// DropOldest discards the oldest queued event to make room for the new one.
+	DropOldest SlowConsumerPolicy = iota
+	// DropNewest discards the new event.
+	DropNewest
+	// RemoveSlow removes the subscription.  Its Err returns ErrSlowConsumer.
+	RemoveSlow
+)
+
+// Subscription delivers every event with a matching method name to a handler.
+// Each subscription has its own goroutine so handlers never block the read loop and events are handled in the order they were received.
+// Events wait for the handler in a queue bounded by the frame's QueueSize, and the frame's SlowConsumer policy applies once it is full.
+type Subscription struct {
+	Method string
+
+	frame   *Frame
+	handler EventHandler
+	size    int
+	policy  SlowConsumerPolicy
+
+	mu      sync.Mutex
+	queue   []json.Unmarshaler
+	dropped int64
+	err     error
+	signal  chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+// On subscribes the handler to all events with the given method name until the returned subscription is removed.
+func (f *Frame) On(method string, handler EventHandler) *Subscription {
+	s := &Subscription{
+		Method:  method,
+		frame:   f,
+		handler: handler,
+		size:    f.QueueSize,
+		policy:  f.SlowConsumer,
+		signal:  make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	f.Lock()
+	f.Subscriptions[method] = append(f.Subscriptions[method], s)
+	f.Unlock()
+
+	go s.run()
+	return s
+}
+
+// WaitForEvent blocks until an event with the given method name is received for which the predicate returns true.
+// A nil predicate matches any event.
+func (f *Frame) WaitForEvent(method string, predicate func(value json.Unmarshaler) bool, timeout time.Duration) (json.Unmarshaler, error) {
+	return f.WaitForEventContext(context.Background(), method, predicate, timeout)
+}
+
+// WaitForEventContext is like WaitForEvent but stops waiting once the context is done.
+func (f *Frame) WaitForEventContext(ctx context.Context, method string, predicate func(value json.Unmarshaler) bool, timeout time.Duration) (json.Unmarshaler, error) {
+	found := make(chan json.Unmarshaler, 1)
+	s := f.On(method, func(value json.Unmarshaler) {
+		if predicate == nil || predicate(value) {
+			select {
+			case found <- value:
+			default:
+			}
+		}
+	})
+	defer s.Remove()
+
+	select {
+	case value := <-found:
+		return value, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(timeout):
+		return nil, fmt.Errorf("event %w %s", ErrTimeout, method)
+	}
+}
+
+// Remove stops delivery of events to the subscription's handler.  Events that have not been handled yet are dropped.
+func (s *Subscription) Remove() {
+	s.once.Do(func() {
+		s.frame.Lock()
+		subs := s.frame.Subscriptions[s.Method]
+		for i, sub := range subs {
+			if sub == s {
+				subs = append(subs[:i], subs[i+1:]...)
+				break
+			}
+		}
+		if len(subs) == 0 {
+			delete(s.frame.Subscriptions, s.Method)
+		} else {
+			s.frame.Subscriptions[s.Method] = subs
+		}
+		s.frame.Unlock()
+
+		close(s.done)
+	})
+}
+
+// Dropped returns the number of events that were discarded because the subscription's queue was full.
+func (s *Subscription) Dropped() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.dropped
+}
+
+// Err returns ErrSlowConsumer once the subscription was removed by the RemoveSlow policy.
+func (s *Subscription) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.err
+}
+
+// push queues the value without waiting on the handler.  A full queue is handled by the subscription's policy.
+func (s *Subscription) push(value json.Unmarshaler) {
+	s.mu.Lock()
+	if s.size > 0 && len(s.queue) >= s.size {
+		s.dropped++
+		if s.dropped == 1 {
+			s.frame.log(LogError, "slow consumer", Field{FieldMethod, s.Method})
+		}
+		switch s.policy {
+		case DropOldest:
+			s.queue = append(s.queue[1:], value)
+		case RemoveSlow:
+			s.err = ErrSlowConsumer
+			s.mu.Unlock()
+			s.Remove()
+			return
+		}
+	} else {
+		s.queue = append(s.queue, value)
+	}
+	s.mu.Unlock()
+
+	select {
+	case s.signal <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Subscription) run() {
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.signal:
+		}
+		for {
+			s.mu.Lock()
+			if len(s.queue) == 0 {
+				s.mu.Unlock()
+				break
+			}
+			value := s.queue[0]
+			s.queue = s.queue[1:]
+			s.mu.Unlock()
+
+			select {
+			case <-s.done:
+				return
+			default:
+			}
+			s.handler(value)
+		}
+	}
+}
+
+// Publish hands the event message to every subscription of the message's method.
+// Each subscription receives its own decoded copy of the event.
+func (f *Frame) Publish(m Message) {
+	f.RLock()
+	subs := append([]*Subscription{}, f.Subscriptions[m.Method]...)
+	f.RUnlock()
+
+	for _, s := range subs {
+		value, ok := lib.GetEventUnmarshaler(m.Method)
+		if !ok {
+			value = &RawEvent{}
+		}
+		if len(m.Params) > 0 {
+			if err := value.UnmarshalJSON(m.Params); err != nil {
+				f.log(LogError, "unmarshal: "+err.Error(), Field{FieldMethod, m.Method})
+				continue
+			}
+		}
+		s.push(value)
+	}
+}
+
+// removeSubscriptions removes every subscription of the frame.
+func (f *Frame) removeSubscriptions() {
+	f.RLock()
+	subs := []*Subscription{}
+	for _, s := range f.Subscriptions {
+		subs = append(subs, s...)
+	}
+	f.RUnlock()
+
+	for _, s := range subs {
+		s.Remove()
+	}
+}
@@ -0,0 +1,178 @@
+package cdp
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/4ydx/cdp/protocol/page"
+	"github.com/gorilla/websocket"
+)
+
+func TestSubscription(t *testing.T) {
+	srv, port := ServeCommands(t, func(c *websocket.Conn, m Message) {
+		if err := c.WriteJSON(map[string]interface{}{"id": m.ID, "result": map[string]string{}}); err != nil {
+			t.Error(err)
+		}
+		for _, id := range []string{"F1", "F2", "F3"} {
+			if err := c.WriteJSON(map[string]interface{}{"method": page.EventPageFrameStoppedLoading, "params": map[string]string{"frameId": id}}); err != nil {
+				t.Error(err)
+			}
+		}
+	})
+	defer srv.Close()
+
+	frame, err := Start(NewTestBrowser(port), LogBasic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer frame.Stop(false)
+
+	var mu sync.Mutex
+	found := []string{}
+	sub := frame.On(page.EventPageFrameStoppedLoading, func(value json.Unmarshaler) {
+		// A slow handler must not hold up the read loop or other subscriptions.
+		time.Sleep(time.Millisecond * 10)
+		mu.Lock()
+		found = append(found, string(value.(*page.FrameStoppedLoadingReply).FrameID))
+		mu.Unlock()
+	})
+
+	waited := make(chan json.Unmarshaler)
+	go func() {
+		value, err := frame.WaitForEvent(page.EventPageFrameStoppedLoading, func(value json.Unmarshaler) bool {
+			return value.(*page.FrameStoppedLoadingReply).FrameID == "F2"
+		}, time.Second*2)
+		if err != nil {
+			t.Error(err)
+		}
+		waited <- value
+	}()
+	for {
+		frame.RLock()
+		count := len(frame.Subscriptions[page.EventPageFrameStoppedLoading])
+		frame.RUnlock()
+		if count == 2 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	err = NewAction(
+		[]Event{},
+		[]Command{
+			Command{ID: frame.RequestID.GetNext(), Method: page.CommandPageBringToFront, Params: &page.BringToFrontArgs{}, Reply: &page.BringToFrontReply{}, Timeout: time.Second * 2},
+		}).Run(frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value := <-waited; value == nil || value.(*page.FrameStoppedLoadingReply).FrameID != "F2" {
+		t.Fatalf("Expecting the F2 event but got %+v", value)
+	}
+
+	until := time.Now().Add(time.Second * 2)
+	for {
+		mu.Lock()
+		count := len(found)
+		mu.Unlock()
+		if count == 3 || time.Now().After(until) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	sub.Remove()
+	sub.Remove()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(found) != 3 || found[0] != "F1" || found[1] != "F2" || found[2] != "F3" {
+		t.Fatalf("Expecting events in order F1 F2 F3 but got %v", found)
+	}
+	if len(frame.Subscriptions) != 0 {
+		t.Fatalf("Expecting no subscriptions but got %d", len(frame.Subscriptions))
+	}
+}
+
+func TestSlowConsumer(t *testing.T) {
+	srv, port := ServeCommands(t, func(c *websocket.Conn, m Message) {
+		// The events are read before the reply so they are all queued once the action completes.
+		for _, id := range []string{"F1", "F2", "F3", "F4", "F5", "F6"} {
+			if err := c.WriteJSON(map[string]interface{}{"method": page.EventPageFrameStoppedLoading, "params": map[string]string{"frameId": id}}); err != nil {
+				t.Error(err)
+			}
+		}
+		if err := c.WriteJSON(map[string]interface{}{"id": m.ID, "result": map[string]string{}}); err != nil {
+			t.Error(err)
+		}
+	})
+	defer srv.Close()
+
+	frame, err := Start(NewTestBrowser(port), LogBasic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer frame.Stop(false)
+	frame.QueueSize = 2
+
+	var mu sync.Mutex
+	release := make(chan struct{})
+	found := map[SlowConsumerPolicy][]string{}
+	subs := map[SlowConsumerPolicy]*Subscription{}
+	for _, policy := range []SlowConsumerPolicy{DropOldest, DropNewest, RemoveSlow} {
+		policy := policy
+		frame.SlowConsumer = policy
+		subs[policy] = frame.On(page.EventPageFrameStoppedLoading, func(value json.Unmarshaler) {
+			<-release
+			mu.Lock()
+			found[policy] = append(found[policy], string(value.(*page.FrameStoppedLoadingReply).FrameID))
+			mu.Unlock()
+		})
+	}
+
+	err = NewAction(
+		[]Event{},
+		[]Command{
+			Command{ID: frame.RequestID.GetNext(), Method: page.CommandPageBringToFront, Params: &page.BringToFrontArgs{}, Reply: &page.BringToFrontReply{}, Timeout: time.Second * 2},
+		}).Run(frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	close(release)
+
+	// At most one event is being handled and two are queued when the rest arrive.
+	until := time.Now().Add(time.Second * 2)
+	for _, policy := range []SlowConsumerPolicy{DropOldest, DropNewest} {
+		dropped := subs[policy].Dropped()
+		if dropped < 3 || dropped > 4 {
+			t.Fatalf("Expecting policy %d to drop 3 or 4 events but got %d", policy, dropped)
+		}
+		for {
+			mu.Lock()
+			count := int64(len(found[policy]))
+			mu.Unlock()
+			if count == 6-dropped || time.Now().After(until) {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if oldest := found[DropOldest]; len(oldest) < 2 || oldest[len(oldest)-2] != "F5" || oldest[len(oldest)-1] != "F6" {
+		t.Fatalf("Expecting the newest events to be kept but got %v", oldest)
+	}
+	if newest := found[DropNewest]; len(newest) < 2 || newest[0] != "F1" || newest[1] != "F2" {
+		t.Fatalf("Expecting the oldest events to be kept but got %v", newest)
+	}
+	if err := subs[RemoveSlow].Err(); err != ErrSlowConsumer {
+		t.Fatalf("Expecting the slow subscription to be removed but got %v", err)
+	}
+	frame.RLock()
+	count := len(frame.Subscriptions[page.EventPageFrameStoppedLoading])
+	frame.RUnlock()
+	if count != 2 {
+		t.Fatalf("Expecting 2 subscriptions but got %d", count)
+	}
+}
@@ -0,0 +1,109 @@
+package cdp
+
+import (
+	"bufio"
+	"io"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+// Transport carries protocol messages between a frame and the browser.
+// A frame calls Send from its write loop and Receive from its read loop, so each is called by one goroutine at a time.
+// Close ends the connection and makes a blocked Receive return an error.  It may be called while a Send is in progress.
+type Transport interface {
+	Send(message []byte) error
+	Receive() ([]byte, error)
+	Close() error
+}
+
+// WebsocketTransport is a Transport over a devtools websocket connection.
+type WebsocketTransport struct {
+	Conn *websocket.Conn
+
+	// writing is held by a Send so that Close does not write its close message at the same time.
+	writing chan struct{}
+	once    sync.Once
+}
+
+// NewWebsocketTransport returns a transport over the connection.
+func NewWebsocketTransport(c *websocket.Conn) *WebsocketTransport {
+	return &WebsocketTransport{Conn: c}
+}
+
+func (t *WebsocketTransport) lock() chan struct{} {
+	t.once.Do(func() {
+		t.writing = make(chan struct{}, 1)
+	})
+	return t.writing
+}
+
+// Send writes the message as a text message.
+func (t *WebsocketTransport) Send(message []byte) error {
+	writing := t.lock()
+	writing <- struct{}{}
+	defer func() { <-writing }()
+
+	return t.Conn.WriteMessage(websocket.TextMessage, message)
+}
+
+// Receive reads the next message.
+func (t *WebsocketTransport) Receive() ([]byte, error) {
+	_, message, err := t.Conn.ReadMessage()
+	return message, err
+}
+
+// Close sends a close message, on a best effort basis, and closes the connection.
+// The close message is skipped while a Send is in progress since closing the connection also ends the send.
+func (t *WebsocketTransport) Close() error {
+	writing := t.lock()
+	select {
+	case writing <- struct{}{}:
+		SendClose(DiscardLogger, t.Conn)
+		<-writing
+	default:
+	}
+	return t.Conn.Close()
+}
+
+// PipeTransport is a Transport over the pipes of a browser started with --remote-debugging-pipe.
+// Each message is JSON followed by a null byte.  The browser reads commands from its file descriptor 3 and writes replies and events to 4.
+type PipeTransport struct {
+	r      *bufio.Reader
+	rc     io.Closer
+	w      io.WriteCloser
+	once   sync.Once
+	closed error
+}
+
+// NewPipeTransport returns a transport that reads the browser's messages from r and writes commands to w.
+// Closing the transport closes both.
+func NewPipeTransport(r io.ReadCloser, w io.WriteCloser) *PipeTransport {
+	return &PipeTransport{r: bufio.NewReader(r), rc: r, w: w}
+}
+
+// Send writes the message followed by a null byte.
+func (t *PipeTransport) Send(message []byte) error {
+	_, err := t.w.Write(append(append([]byte{}, message...), 0))
+	return err
+}
+
+// Receive reads up to the next null byte.
+func (t *PipeTransport) Receive() ([]byte, error) {
+	message, err := t.r.ReadBytes(0)
+	if err != nil {
+		return nil, err
+	}
+	return message[:len(message)-1], nil
+}
+
+// Close closes both pipes.  A browser whose pipe is closed shuts down.  Closing more than once returns the result of the first close.
+func (t *PipeTransport) Close() error {
+	t.once.Do(func() {
+		t.closed = t.w.Close()
+		if err := t.rc.Close(); t.closed == nil {
+			t.closed = err
+		}
+	})
+	return t.closed
+}
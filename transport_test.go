@@ -0,0 +1,115 @@
+package cdp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/4ydx/cdp/protocol/page"
+)
+
+func TestPipeTransport(t *testing.T) {
+	// The browser's ends of the pipes.
+	commands, commandsW, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	repliesR, replies, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer replies.Close()
+		r := bufio.NewReader(commands)
+		for {
+			command, err := r.ReadBytes(0)
+			if err != nil {
+				return
+			}
+			m := Message{}
+			if err := json.Unmarshal(command[:len(command)-1], &m); err != nil {
+				t.Error(err)
+				return
+			}
+			fmt.Fprintf(replies, `{"id":%d,"result":{}}`+"\x00", m.ID)
+		}
+	}()
+
+	frame := StartWithTransport(NewTestBrowser(0), NewPipeTransport(repliesR, commandsW), LogBasic)
+	for i := 0; i < 3; i++ {
+		err := NewAction(
+			[]Event{},
+			[]Command{
+				Command{ID: frame.RequestID.GetNext(), Method: page.CommandPageBringToFront, Params: &page.BringToFrontArgs{}, Reply: &page.BringToFrontReply{}, Timeout: time.Second * 2},
+			}).Run(frame)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := frame.Stop(false); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second * 2):
+		t.Fatal("Expecting the browser to see its command pipe closed")
+	}
+}
+
+func TestNewBrowserPipe(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cdp-fake-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The fake browser saves its arguments and the commands that it reads from file descriptor 3 until the pipe is closed.
+	path := FakeBrowser(t, fmt.Sprintf("echo \"$@\" > %s/args\n[ -e /proc/$$/fd/4 ] || exit 1\nexec cat <&3 > %s/commands\n", dir, dir))
+	defer os.RemoveAll(filepath.Dir(path))
+
+	browser, err := NewBrowserWithOptions(LaunchOptions{Path: path, Pipe: true, LogFile: filepath.Join(dir, "browser.log")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Start(browser, LogBasic); err == nil {
+		t.Fatal("Expecting a browser launched with a pipe to require StartBrowser")
+	}
+	frame, err := StartBrowser(browser, LogBasic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = NewAction(
+		[]Event{},
+		[]Command{
+			Command{ID: frame.RequestID.GetNext(), Method: page.CommandPageBringToFront, Params: &page.BringToFrontArgs{}, Reply: &page.BringToFrontReply{}, Timeout: time.Millisecond * 100},
+		}).Run(frame)
+	if err == nil {
+		t.Fatal("Expecting the unanswered command to time out")
+	}
+	if err := frame.Stop(true); err != nil {
+		t.Fatal(err)
+	}
+
+	args, err := ioutil.ReadFile(filepath.Join(dir, "args"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(args), "--remote-debugging-pipe") || strings.Contains(string(args), "--remote-debugging-port") {
+		t.Fatalf("Expecting the pipe flag in place of a debugging port but got %s", args)
+	}
+	sent, err := ioutil.ReadFile(filepath.Join(dir, "commands"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(sent), `{"id":`) || !strings.HasSuffix(string(sent), "\x00") || !strings.Contains(string(sent), page.CommandPageBringToFront) {
+		t.Fatalf("Expecting the null terminated command on file descriptor 3 but got %q", sent)
+	}
+}
@@ -1,184 +1,316 @@
 package cdp
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"net/http"
-	"os"
-	"os/signal"
+	"time"
 
 	"github.com/4ydx/cdp/protocol/dom"
 	"github.com/4ydx/cdp/protocol/lib"
+	"github.com/4ydx/cdp/protocol/target"
 	"github.com/gorilla/websocket"
 )
 
-// GetWebsocket returns a websocket connection to the running browser.
-func GetWebsocket(lg *log.Logger, port int) *websocket.Conn {
-	r, err := http.Get(fmt.Sprintf("http://localhost:%d/json", port))
+// GetWebsocket returns a websocket connection to a page target of the running browser.
+func GetWebsocket(lg Logger, port int) (*websocket.Conn, error) {
+	ws, err := pageWebsocketURL(lg, port)
 	if err != nil {
-		lg.Fatal(err)
+		return nil, err
+	}
+	return dial(lg, ws)
+}
+
+// pageWebsocketURL returns the websocket url of the last page target listed by the running browser.
+func pageWebsocketURL(lg Logger, port int) (string, error) {
+	targets := []map[string]interface{}{}
+	if err := getJSON(lg, fmt.Sprintf("http://localhost:%d/json", port), &targets); err != nil {
+		return "", err
+	}
+	ws := ""
+	for _, entry := range targets {
+		if v, ok := entry["webSocketDebuggerUrl"].(string); ok {
+			ws = v
+		}
+	}
+	return ws, nil
+}
+
+// GetBrowserWebsocket returns a websocket connection to the browser target of the running browser.
+// Page targets are then reached through sessions created with the Target domain.
+func GetBrowserWebsocket(lg Logger, port int) (*websocket.Conn, error) {
+	ws, err := browserWebsocketURL(lg, port)
+	if err != nil {
+		return nil, err
+	}
+	return dial(lg, ws)
+}
+
+// browserWebsocketURL returns the websocket url of the browser target of the running browser.
+func browserWebsocketURL(lg Logger, port int) (string, error) {
+	version := map[string]interface{}{}
+	if err := getJSON(lg, fmt.Sprintf("http://localhost:%d/json/version", port), &version); err != nil {
+		return "", err
+	}
+	ws, _ := version["webSocketDebuggerUrl"].(string)
+	return ws, nil
+}
+
+// getJSON decodes the reply of a devtools http endpoint into the given value.
+func getJSON(lg Logger, url string, value interface{}) error {
+	return fetchJSON(context.Background(), lg, http.DefaultClient, url, nil, value)
+}
+
+// fetchJSON is like getJSON but sends the given headers with the request and stops waiting on the endpoint once the context is done.
+func fetchJSON(ctx context.Context, lg Logger, client *http.Client, url string, header http.Header, value interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		lg.Log(LogError, err.Error())
+		return err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	r, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		lg.Log(LogError, err.Error())
+		return err
 	}
 	defer func() {
 		err := r.Body.Close()
 		if err != nil {
-			panic(err)
+			lg.Log(LogError, err.Error())
 		}
 	}()
 
 	b, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		lg.Fatal(err)
+		lg.Log(LogError, err.Error())
+		return err
 	}
-	var inter interface{}
-	err = json.Unmarshal(b, &inter)
+	err = json.Unmarshal(b, value)
 	if err != nil {
-		lg.Fatal(err)
+		lg.Log(LogError, err.Error())
+		return err
 	}
+	return nil
+}
 
-	ws := ""
-	arr := inter.([]interface{})
-	for i := 0; i < len(arr); i++ {
-		entry := arr[i].(map[string]interface{})
-		for k, v := range entry {
-			if k == "webSocketDebuggerUrl" {
-				ws = v.(string)
-			}
-		}
-	}
+// dial connects to the given websocket url.
+func dial(lg Logger, ws string) (*websocket.Conn, error) {
+	return dialContext(context.Background(), lg, websocket.DefaultDialer, ws, nil)
+}
+
+// dialContext is like dial but sends the given headers with the handshake and stops waiting on the endpoint once the context is done.
+func dialContext(ctx context.Context, lg Logger, d *websocket.Dialer, ws string, header http.Header) (*websocket.Conn, error) {
 	if ws == "" {
-		lg.Fatal("No websocket url found.")
+		err := errors.New("no websocket url found")
+		lg.Log(LogError, err.Error())
+		return nil, err
 	}
-	c, _, err := websocket.DefaultDialer.Dial(ws, nil)
+	c, _, err := d.DialContext(ctx, ws, header)
 	if err != nil {
-		lg.Fatal(err)
+		lg.Log(LogError, err.Error())
+		return nil, err
 	}
-	return c
+	return c, nil
 }
 
 // UpdateDOMEvent takes the event and, for a certain subset of events, makes sure that the current DOM object is updated.
 func UpdateDOMEvent(frame *Frame, method string, event json.Unmarshaler) {
+	frame.Lock()
+	defer frame.Unlock()
+
 	switch method {
 	case dom.EventDOMDocumentUpdated:
 		frame.DOM = nil
 	case dom.EventDOMSetChildNodes:
-		frame.setChildNodes(&event.(*dom.SetChildNodesReply).Nodes)
+		if frame.DOM != nil {
+			frame.setChildNodes(&event.(*dom.SetChildNodesReply).Nodes)
+		}
 	}
 }
 
+// exitGrace is how long Read waits to learn whether a closed connection was caused by the browser exiting.
+var exitGrace = time.Millisecond * 100
+
 // Read reads replies from the server over the websocket.
+// Messages that carry a sessionId are handled by the matching session Frame.
 func Read(frame *Frame) {
+	if frame.readDone != nil {
+		defer close(frame.readDone)
+	}
 	for {
-		_, message, err := frame.Conn.ReadMessage()
-		if err != nil {
-			frame.Browser.Log.Println("Read error:", err)
+		message, err := frame.transport().Receive()
+		if err != nil && frame.closing() {
+			frame.log(LogDetails, "read: "+err.Error())
+			frame.failAll(fmt.Errorf("%w: frame closed", ErrConnectionClosed))
 			return
 		}
-		if frame.LogLevel > LogBasic {
-			frame.Browser.Log.Printf(".RAW: %s\n", message)
+		if err != nil {
+			frame.log(LogError, "read: "+err.Error())
+			cause := err
+			err = fmt.Errorf("%w: %s", ErrConnectionClosed, err)
+
+			// A browser that exits closes the connection too, so give the process a moment to be reaped and report the exit instead.
+			if frame.Browser != nil && frame.Browser.Done() != nil {
+				select {
+				case <-frame.Browser.Done():
+					err = frame.browserExited()
+				case <-time.After(exitGrace):
+				}
+			}
+			if !errors.Is(err, ErrBrowserExited) && frame.reconnect(cause) {
+				continue
+			}
+			frame.setState(ConnClosed, err)
+			frame.failAll(err)
+			return
 		}
+		frame.log(LogAll, "message", Field{FieldDirection, DirectionReceive}, Field{FieldMessage, string(message)})
+		frame.record(DirectionReceive, message)
+		frame.history.add(message)
 
 		m := Message{}
 		err = json.Unmarshal(message, &m)
 		if err != nil {
-			frame.Browser.Log.Fatal("Unmarshal error:", err)
+			frame.log(LogError, "unmarshal: "+err.Error(), Field{FieldMessage, string(message)})
+			continue
+		}
+
+		if m.SessionID == "" {
+			frame.handle(m, message)
+			continue
+		}
+		if session := frame.GetSession(m.SessionID); session != nil {
+			session.handle(m, message)
+			continue
 		}
-		//frame.Browser.Log.Printf(".DEC: %+v\n", m)
+		frame.log(LogDetails, "skipped message for unknown session", Field{FieldSessionID, m.SessionID}, Field{FieldMethod, m.Method})
+	}
+}
 
-		if m.Method == "Runtime.consoleAPICalled" {
+// handle processes a single message that was sent to the frame.
+func (frame *Frame) handle(m Message, message []byte) {
+	if m.Method == "Runtime.consoleAPICalled" {
+		if frame.Browser != nil && frame.Browser.Console != nil {
 			frame.Browser.Console.Print(string(message))
 		}
+	}
+	if m.Method == target.EventTargetDetachedFromTarget {
+		detached := &target.DetachedFromTargetReply{}
+		if err := detached.UnmarshalJSON(m.Params); err == nil {
+			frame.RemoveSession(string(detached.SessionID))
+		}
+	}
+	if m.Method != "" {
+		frame.Publish(m)
+	}
+
+	if act := frame.GetCommandAction(m.ID); m.ID != 0 && act != nil {
+		// All messages with an ID matching a command are set here.
+		if m.Error != nil {
+			frame.SetError(act, m)
+			return
+		}
+		advanced, err := frame.SetResult(act, m)
+		if err != nil {
+			frame.FailAction(act, err)
+			return
+		}
+		if advanced {
+			frame.Advance(act)
+		}
+		return
+	}
 
-		hasCommand, hasEvent := false, false
-		if hasCommand = frame.HasCommandID(m.ID); hasCommand {
-			// All messages with an ID matching a command are set here.
-			err := frame.SetResult(frame, m)
+	// Check and then set Events related to the active Actions.
+	if acts := frame.GetEventActions(m.Method); len(acts) > 0 {
+		var value CommandReply
+		for _, act := range acts {
+			v, err := frame.SetEvent(act, m.Method, m)
 			if err != nil {
-				// An unmarshal error means that the server sent an error message.  Retry.
-				frame.ActionChan <- frame.ToJSON()
+				frame.log(LogError, err.Error(), Field{FieldMethod, m.Method})
 				continue
 			}
-		} else if hasEvent = frame.HasEvent(m.Method); hasEvent {
-			// Check and then set Events related to the current Action.
-			err = frame.SetEvent(frame, m.Method, m)
-			if err != nil {
-				frame.Browser.Log.Fatal(err)
+			if v != nil && value == nil {
+				value = v
 			}
 		}
-
-		// If matched a command or an event, then this message is fully processed.
-		if hasCommand || hasEvent {
-			if frame.IsComplete() {
-				frame.Browser.Log.Printf("Action Completed %s %s", frame.GetCommandMethod(), frame.GetFrameID())
-				frame.Clear()
-				frame.CacheCompleteChan <- struct{}{}
-			} else if !frame.IsCommandComplete() {
-				frame.Browser.Log.Printf("Action Next Command %s %s", frame.GetCommandMethod(), frame.GetFrameID())
-				frame.ActionChan <- frame.ToJSON()
-				frame.CommandChan <- frame.CommandTimeout()
-			} else {
-				frame.Browser.Log.Printf("Action Event Waiting %s %s", frame.GetCommandMethod(), frame.GetFrameID())
-			}
-			continue
+		if value != nil {
+			UpdateDOMEvent(frame, m.Method, value)
+		}
+		for _, act := range acts {
+			frame.CheckComplete(act)
 		}
+		return
+	}
 
-		// Generic unmarshaler for all other Events.
-		e, ok := lib.GetEventUnmarshaler(m.Method)
-		if ok {
-			if len(m.Result) > 0 {
-				err := e.UnmarshalJSON(m.Result)
-				if err != nil {
-					frame.Browser.Log.Fatal("Unmarshal error:", err, m.Result)
-				}
-			}
-			if len(m.Params) > 0 {
-				err := e.UnmarshalJSON(m.Params)
-				if err != nil {
-					frame.Browser.Log.Fatal("Unmarshal error:", err, m.Params)
-				}
-			}
-			if frame.LogLevel > LogBasic {
-				frame.Browser.Log.Printf(".GOT event %+v\n", e)
+	// Generic unmarshaler for all other Events.
+	e, ok := lib.GetEventUnmarshaler(m.Method)
+	if ok {
+		if len(m.Result) > 0 {
+			err := e.UnmarshalJSON(m.Result)
+			if err != nil {
+				frame.log(LogError, "unmarshal: "+err.Error(), Field{FieldMethod, m.Method}, Field{FieldMessage, string(m.Result)})
+				return
 			}
-			UpdateDOMEvent(frame, m.Method, e)
-		} else {
-			if frame.LogLevel > LogBasic {
-				frame.Browser.Log.Printf(".SKP event %s %s %s\n", m.Method, m.Params, m.Result)
+		}
+		if len(m.Params) > 0 {
+			err := e.UnmarshalJSON(m.Params)
+			if err != nil {
+				frame.log(LogError, "unmarshal: "+err.Error(), Field{FieldMethod, m.Method}, Field{FieldMessage, string(m.Params)})
+				return
 			}
 		}
+		frame.log(LogDetails, "event", Field{FieldMethod, m.Method}, Field{FieldMessage, fmt.Sprintf("%+v", e)})
+		UpdateDOMEvent(frame, m.Method, e)
+	} else {
+		frame.log(LogDetails, "skipped event", Field{FieldMethod, m.Method}, Field{FieldMessage, string(m.Params)})
 	}
 }
 
 // Write writes requests to the server over the websocket.
 func Write(frame *Frame) {
-	osInterrupt := make(chan os.Signal, 1)
-	signal.Notify(osInterrupt, os.Interrupt)
-
+	if frame.writeDone != nil {
+		defer close(frame.writeDone)
+	}
 	for {
 		select {
-		case command := <-frame.ActionChan:
-			frame.Browser.Log.Printf("!REQ: %s\n", command)
-			err := frame.Conn.WriteMessage(websocket.TextMessage, command)
+		case o := <-frame.actionChan:
+			frame.log(LogBasic, "message", Field{FieldDirection, DirectionSend}, Field{FieldMessage, string(o.message)})
+			frame.record(DirectionSend, o.message)
+			t := frame.transport()
+			o.frame.commandWriting(o)
+			err := t.Send(o.message)
+			if err != nil && frame.Reconnect != nil {
+				// Closing the connection lets the read loop reconnect.  The command's action fails with ErrConnectionReset.
+				frame.log(LogError, "write: "+err.Error())
+				t.Close()
+				continue
+			}
 			if err != nil {
-				frame.Browser.Log.Println("write:", err)
+				frame.log(LogError, "write: "+err.Error())
+				frame.setState(ConnClosed, err)
+				frame.failAll(fmt.Errorf("%w: %s", ErrConnectionClosed, err))
 				return
 			}
+			o.frame.commandSent(o.info, o.queued)
 		case <-frame.AllComplete:
-			SendClose(frame.Browser.Log, frame.Conn)
-			return
-		case <-osInterrupt:
-			SendClose(frame.Browser.Log, frame.Conn)
+			// Close closes the transport and waits for the write loop to return.
 			return
 		}
 	}
 }
 
 // SendClose closes the websocket.
-func SendClose(lg *log.Logger, c *websocket.Conn) {
+func SendClose(lg Logger, c *websocket.Conn) {
 	// Cleanly close the connection by sending a close message and then waiting (with timeout) for the server to close the connection.
 	err := c.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
 	if err != nil {
-		lg.Println("write close err:", err)
+		lg.Log(LogError, "write close: "+err.Error())
 	}
 }
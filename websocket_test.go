@@ -1,6 +1,7 @@
 package cdp
 
 import (
+	"io/ioutil"
 	"log"
 	"os"
 	"testing"
@@ -12,11 +13,14 @@ func TestShutdown(t *testing.T) {
 	srv := Serve()
 	defer ServerClose(srv)
 
-	lg := log.New(os.Stderr, "", log.LstdFlags)
-	c := GetWebsocket(lg, 8080)
+	lg := NewStdLogger(log.New(os.Stderr, "", log.LstdFlags))
+	c, err := GetWebsocket(lg, 8080)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	// Direct use of the connection to see that data is sent/received.
-	err := c.WriteMessage(websocket.TextMessage, []byte("hello"))
+	err = c.WriteMessage(websocket.TextMessage, []byte("hello"))
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -36,3 +40,10 @@ func TestShutdown(t *testing.T) {
 	}
 	t.Log("shutdown err", err)
 }
+
+func TestGetWebsocketUnreachable(t *testing.T) {
+	lg := NewStdLogger(log.New(ioutil.Discard, "", log.LstdFlags))
+	if _, err := GetWebsocket(lg, 1); err == nil {
+		t.Fatal("expecting an error when no browser is listening")
+	}
+}